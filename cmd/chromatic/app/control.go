@@ -0,0 +1,144 @@
+/*
+Copyright © 2020 Richard Cox
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package app
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/Khabi/chromatic/internal/api"
+	"github.com/Khabi/chromatic/internal/config"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// control runs a command against the running service.
+func control(send func(c *api.Client) error, done string) func(cmd *cobra.Command, args []string) {
+	return func(cmd *cobra.Command, args []string) {
+		if err := send(apiClient(cmd, api.ScopeControl)); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Println(done)
+	}
+}
+
+// startCmd represents the start command
+var startCmd = &cobra.Command{
+	Use:   "start",
+	Short: "Start capturing in the running service",
+	Args:  cobra.NoArgs,
+	Run:   control((*api.Client).Start, "capture started"),
+}
+
+// pauseCmd represents the pause command
+var pauseCmd = &cobra.Command{
+	Use:   "pause",
+	Short: "Pause capturing in the running service",
+	Args:  cobra.NoArgs,
+	Run:   control((*api.Client).Pause, "capture paused"),
+}
+
+// stopCmd represents the stop command
+var stopCmd = &cobra.Command{
+	Use:   "stop",
+	Short: "Stop the running service",
+	Args:  cobra.NoArgs,
+	Run:   control((*api.Client).Stop, "service is stopping"),
+}
+
+// modeCmd represents the mode command
+var modeCmd = &cobra.Command{
+	Use:       "mode <average|prominent>",
+	Short:     "Switch how the running service picks colors",
+	Args:      cobra.ExactArgs(1),
+	ValidArgs: []string{"average", "prominent"},
+	Run: func(cmd *cobra.Command, args []string) {
+		control(func(c *api.Client) error { return c.Mode(args[0]) }, "switched to "+args[0])(cmd, args)
+	},
+}
+
+// apiClient connects to the address flag, or what the config file
+// listens on, preferring the socket.  Without --token it uses one from the
+// config file that has the scope.
+func apiClient(cmd *cobra.Command, scope string) *api.Client {
+	address, _ := cmd.Flags().GetString("address")
+	secure := viper.GetString("tls.cert") != "" || viper.GetBool("tls.self_signed")
+	switch {
+	case address != "":
+	case viper.GetString("socket.path") != "":
+		address = viper.GetString("socket.path")
+	case viper.GetString("bind") != "":
+		address = api.URL(viper.GetString("bind"), secure)
+	default:
+		fmt.Fprintln(os.Stderr, "No address to reach chromatic at, set bind or socket.path in the config file or use --address")
+		os.Exit(1)
+	}
+
+	var opts api.ClientOptions
+	opts.Token, _ = cmd.Flags().GetString("token")
+	opts.CA, _ = cmd.Flags().GetString("ca")
+	opts.Insecure, _ = cmd.Flags().GetBool("insecure")
+	if opts.Token == "" {
+		opts.Token = configToken(scope)
+	}
+	if opts.CA == "" && viper.GetBool("tls.self_signed") {
+		opts.CA = viper.GetString("tls.cert")
+	}
+
+	c, err := api.NewClient(address, opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	return c
+}
+
+// configToken finds a token in the config file that can be used for scope.
+func configToken(scope string) string {
+	var tokens []config.Token
+	if err := viper.UnmarshalKey("tokens", &tokens); err != nil {
+		return ""
+	}
+	for _, t := range tokens {
+		// Control tokens can read too.
+		if t.Scope == scope || t.Scope == api.ScopeControl || (t.Scope == "" && scope == api.ScopeRead) {
+			return t.Token
+		}
+	}
+	return ""
+}
+
+// addressFlag adds the flags for where the service is and how to reach it.
+func addressFlag(cmd *cobra.Command) {
+	cmd.Flags().String("address", "", "Address of the service, like http://localhost:8080 or /run/chromatic.sock (default is from the config file)")
+	cmd.Flags().String("token", "", "Token to use with the service (default is from the config file)")
+	cmd.Flags().String("ca", "", "Certificate to trust for https (default is tls.cert for a self signed certificate)")
+	cmd.Flags().Bool("insecure", false, "Don't verify the certificate of the service")
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{startCmd, pauseCmd, stopCmd, modeCmd} {
+		rootCmd.AddCommand(cmd)
+		addressFlag(cmd)
+	}
+}
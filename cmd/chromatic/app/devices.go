@@ -22,10 +22,12 @@ THE SOFTWARE.
 package app
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
 
-	"github.com/korandiz/v4l"
+	"github.com/Khabi/chromatic/internal/video"
 	"github.com/spf13/cobra"
 )
 
@@ -34,15 +36,64 @@ var devicesCmd = &cobra.Command{
 	Use:   "devices",
 	Short: "List compatible video devices",
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("supported devices")
-		devs := v4l.FindDevices()
+		asJSON, _ := cmd.Flags().GetBool("json")
+		all, _ := cmd.Flags().GetBool("all")
 
-		for _, info := range devs {
-			fmt.Fprintln(os.Stderr, " ", info.Path)
+		devs, err := video.Find()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		// Most capture devices also have a metadata node.
+		if !all {
+			var capture []video.Device
+			for _, d := range devs {
+				if d.Capture {
+					capture = append(capture, d)
+				}
+			}
+			devs = capture
+		}
+
+		if asJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(devs); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		}
+
+		if len(devs) == 0 {
+			fmt.Fprintln(os.Stderr, "no video devices found")
+			os.Exit(1)
+		}
+		fmt.Println("Video devices:")
+		for _, d := range devs {
+			fmt.Printf("  %s: %s (%s, %s)\n", d.Path, d.Name, d.Driver, d.Bus)
+			for _, link := range d.ByID {
+				fmt.Printf("    by-id: %s\n", link)
+			}
+			fmt.Printf("    capture: %s, mjpeg: %s", yesNo(d.Capture), yesNo(d.SupportsMJPEG()))
+			if len(d.Formats) > 0 {
+				fmt.Printf(", formats: %s", strings.Join(d.Formats, ", "))
+			}
+			fmt.Println()
 		}
 	},
 }
 
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
 func init() {
 	rootCmd.AddCommand(devicesCmd)
+
+	devicesCmd.Flags().Bool("json", false, "Print the devices as json")
+	devicesCmd.Flags().Bool("all", false, "Include nodes that can't capture video, like metadata nodes")
 }
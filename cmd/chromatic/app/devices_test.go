@@ -0,0 +1,15 @@
+package app
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/Khabi/chromatic/internal/video"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDevicesJSON(t *testing.T) {
+	// Whatever devices there are, stdout is only the json.
+	var devices []video.Device
+	assert.NoError(t, json.Unmarshal(run(t, "devices", "--json", "--all"), &devices))
+}
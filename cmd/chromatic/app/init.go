@@ -0,0 +1,211 @@
+/*
+Copyright © 2020 Richard Cox <code@bot37.com>
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package app
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GetVivid/huego"
+	"github.com/Khabi/chromatic/internal/location"
+	"github.com/Khabi/chromatic/internal/video"
+	"github.com/korandiz/v4l"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// initCmd represents the init command
+var initCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Interactively create a config file",
+	Run: func(cmd *cobra.Command, args []string) {
+		in := bufio.NewReader(os.Stdin)
+		cfg := viper.New()
+
+		file, err := configPath()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if _, err := os.Stat(file); err == nil {
+			if !confirm(in, fmt.Sprintf("%s already exists, overwrite it?", file)) {
+				return
+			}
+		}
+
+		// Video device, saved by its stable path so it survives a reboot.
+		found, err := video.Find()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		var devs []video.Device
+		var names []string
+		for _, d := range found {
+			if d.Capture {
+				devs = append(devs, d)
+				names = append(names, fmt.Sprintf("%s (%s)", d.Path, d.Name))
+			}
+		}
+		if len(devs) == 0 {
+			fmt.Fprintln(os.Stderr, "no video devices found")
+			os.Exit(1)
+		}
+		chosen := devs[choose(in, "Video device", names)]
+		cfg.Set("video.device", chosen.Stable())
+
+		// Video profile
+		dev, err := v4l.Open(chosen.Path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		configs, err := dev.ListConfigs()
+		dev.Close()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		var profiles []string
+		for _, c := range configs {
+			if p := profileOf(c); p.Supported {
+				profiles = append(profiles, p.Profile)
+			}
+		}
+		if len(profiles) == 0 {
+			fmt.Fprintln(os.Stderr, "no supported profiles")
+			os.Exit(1)
+		}
+		cfg.Set("video.profile", profiles[choose(in, "Video profile", profiles)])
+
+		// Hue bridge
+		host := ask(in, "Hue bridge address (blank to search)", "")
+		if host == "" {
+			bridges, err := huego.DiscoverAll()
+			if err != nil || len(bridges) == 0 {
+				fmt.Fprintln(os.Stderr, "no hue bridges found")
+				os.Exit(1)
+			}
+			var hosts []string
+			for _, b := range bridges {
+				hosts = append(hosts, b.Host)
+			}
+			host = hosts[choose(in, "Hue bridge", hosts)]
+		}
+		cfg.Set("light.bridge", host)
+
+		timeout := 30 * time.Second
+		fmt.Printf("Press the link button on the hub within %s...\n", timeout)
+		user, clientkey, err := waitForUser(&huego.Bridge{Host: host}, timeout)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating user: %s\n", err.Error())
+			os.Exit(1)
+		}
+		cfg.Set("light.username", user)
+		cfg.Set("light.client_key", clientkey)
+
+		// Entertainment group
+		bridge := huego.New(host, user, clientkey)
+		groups, err := bridge.GetEntertainmentGroups()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if len(groups) == 0 {
+			fmt.Fprintln(os.Stderr, "no entertainment groups, create one in the hue app first")
+			os.Exit(1)
+		}
+		var groupNames []string
+		for _, g := range groups {
+			groupNames = append(groupNames, fmt.Sprintf("%s (lights %s)", g.Name, strings.Join(g.Lights, ",")))
+		}
+		group := groups[choose(in, "Entertainment group", groupNames)]
+		cfg.Set("light.group_id", group.ID)
+
+		// Light bindings, guessed from where the light sits in the room.
+		for id, loc := range group.Locations {
+			preset := location.PresetName(location.Nearest(loc.X, loc.Y))
+			cfg.Set(fmt.Sprintf("light.binding.%d", id), preset)
+			fmt.Printf("  light %d: %s\n", id, preset)
+		}
+
+		cfg.Set("bind", ask(in, "API listen address", ":8080"))
+		cfg.Set("log_level", "info")
+
+		if err := writeConfig(cfg, file); err != nil {
+			fmt.Fprintf(os.Stderr, "Error saving config: %s\n", err.Error())
+			os.Exit(1)
+		}
+		fmt.Printf("Config written to %s\n", file)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(initCmd)
+}
+
+// ask prompts for a line of input, returning def when nothing is entered.
+func ask(in *bufio.Reader, question string, def string) string {
+	if def != "" {
+		fmt.Printf("%s [%s]: ", question, def)
+	} else {
+		fmt.Printf("%s: ", question)
+	}
+
+	line, _ := in.ReadString('\n')
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return def
+	}
+	return line
+}
+
+// confirm asks a yes or no question, defaulting to no.
+func confirm(in *bufio.Reader, question string) bool {
+	answer := strings.ToLower(ask(in, question+" (y/N)", ""))
+	return answer == "y" || answer == "yes"
+}
+
+// choose lists the options and asks until a valid one is picked,
+// returning its index.  A single option is picked without asking.
+func choose(in *bufio.Reader, question string, options []string) int {
+	if len(options) == 1 {
+		fmt.Printf("%s: %s\n", question, options[0])
+		return 0
+	}
+
+	fmt.Printf("%s:\n", question)
+	for i, o := range options {
+		fmt.Printf("  %d: %s\n", i+1, o)
+	}
+	for {
+		n, err := strconv.Atoi(ask(in, "Choose", "1"))
+		if err == nil && n >= 1 && n <= len(options) {
+			return n - 1
+		}
+		fmt.Println("invalid choice")
+	}
+}
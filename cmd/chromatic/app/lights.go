@@ -26,6 +26,7 @@ import (
 	"os"
 	"strings"
 
+	"github.com/Khabi/chromatic/internal/hue"
 	"github.com/spf13/cobra"
 
 	"github.com/GetVivid/huego"
@@ -39,6 +40,14 @@ var lightsCmd = &cobra.Command{
 		host, _ := cmd.Flags().GetString("host")
 		username, _ := cmd.Flags().GetString("username")
 
+		if v2, _ := cmd.Flags().GetBool("v2"); v2 {
+			if err := listConfigurations(host, username); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		}
+
 		bridge := huego.New(host, username, "")
 		groups, err := bridge.GetEntertainmentGroups()
 
@@ -55,11 +64,66 @@ var lightsCmd = &cobra.Command{
 	},
 }
 
+// listConfigurations prints the v2 entertainment configurations and
+// the lights, or gradient segments, behind each channel.
+func listConfigurations(host, username string) error {
+	client, err := hue.NewClient(host, username)
+	if err != nil {
+		return err
+	}
+	configs, err := client.EntertainmentConfigurations()
+	if err != nil {
+		return err
+	}
+	devices, err := client.Devices()
+	if err != nil {
+		return err
+	}
+
+	// Entertainment services belong to a device, which has the name.
+	names := make(map[string]string)
+	for _, d := range devices {
+		for _, s := range d.Services {
+			names[s.RID] = d.Name()
+		}
+	}
+
+	fmt.Println("Hue Entertainment Configurations")
+	for _, c := range configs {
+		fmt.Printf("  %s: %s (%s)\n", c.ID, c.Name(), c.Type)
+
+		// Gradient lights have a channel for each segment.
+		channels := make(map[string]int)
+		for _, ch := range c.Channels {
+			for _, m := range ch.Members {
+				channels[m.Service.RID]++
+			}
+		}
+
+		for _, ch := range c.Channels {
+			var members []string
+			for _, m := range ch.Members {
+				name, ok := names[m.Service.RID]
+				if !ok {
+					name = m.Service.RID
+				}
+				if channels[m.Service.RID] > 1 {
+					name = fmt.Sprintf("%s segment %d", name, m.Index)
+				}
+				members = append(members, name)
+			}
+			fmt.Printf("    Channel %d at %.2f,%.2f: %s\n", ch.ID, ch.Position.X, ch.Position.Y, strings.Join(members, ", "))
+		}
+	}
+	return nil
+}
+
 func init() {
 	rootCmd.AddCommand(lightsCmd)
 
 	lightsCmd.Flags().StringP("host", "a", "", "Philips Hue hub address")
 	lightsCmd.Flags().StringP("username", "u", "", "Philips Hue username")
+	lightsCmd.Flags().Bool("v2", false, "List v2 entertainment configurations and their channels")
 
 	lightsCmd.MarkFlagRequired("host")
 	lightsCmd.MarkFlagRequired("username")
@@ -22,45 +22,206 @@ THE SOFTWARE.
 package app
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"time"
 
+	"github.com/Khabi/chromatic/internal/config"
+	"github.com/Khabi/chromatic/internal/decode"
+	"github.com/Khabi/chromatic/internal/video"
 	"github.com/korandiz/v4l"
 	"github.com/spf13/cobra"
 )
 
+// deviceProfile is a configuration the device supports.
+type deviceProfile struct {
+	Profile   string       `json:"profile"` // what goes in video.profile
+	Format    string       `json:"format"`
+	Width     int          `json:"width"`
+	Height    int          `json:"height"`
+	FPS       float64      `json:"fps"`
+	Frames    uint32       `json:"fps_numerator"`
+	Per       uint32       `json:"fps_denominator"`
+	Supported bool         `json:"supported"` // chromatic can read the format
+	Test      *profileTest `json:"test,omitempty"`
+}
+
+// profileTest is what capturing with a profile measured.
+type profileTest struct {
+	FPS    float64 `json:"fps"`
+	Decode float64 `json:"decode_ms"` // average time to decode a frame
+	Error  string  `json:"error,omitempty"`
+}
+
 // profilesCmd represents the profiles command
 var profilesCmd = &cobra.Command{
 	Use:   "profiles",
 	Short: "List supported profiles for the video device",
 	Run: func(cmd *cobra.Command, args []string) {
 		device, _ := cmd.Flags().GetString("device")
+		asJSON, _ := cmd.Flags().GetBool("json")
+		test, _ := cmd.Flags().GetBool("test")
+		frames, _ := cmd.Flags().GetInt("frames")
+		mode, _ := cmd.Flags().GetString("decode")
 
-		stream, err := v4l.Open(device)
-		if err != nil {
+		if _, err := decode.Parse(mode); err != nil {
 			fmt.Fprintln(os.Stderr, err)
 			os.Exit(1)
 		}
+		if frames < 1 {
+			fmt.Fprintln(os.Stderr, "frames must be at least 1")
+			os.Exit(1)
+		}
 
-		configs, err := stream.ListConfigs()
+		profiles, err := listProfiles(device, test, frames, mode)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err)
 			os.Exit(1)
 		}
 
-		if len(configs) == 0 {
-			fmt.Fprintln(os.Stderr, "no supported profiles")
-			os.Exit(1)
+		if asJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(profiles); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
 		}
+
 		fmt.Printf("Supported device profiles for %s:\n", device)
-		for _, cfg := range configs {
-			fmt.Printf("  %dx%d@%dfps\n", cfg.Width, cfg.Height, cfg.FPS.N)
+		for _, p := range profiles {
+			rate := fmt.Sprintf("%d", p.Frames)
+			if p.Per != 1 {
+				rate = fmt.Sprintf("%d/%d (%.2f)", p.Frames, p.Per, p.FPS)
+			}
+			line := fmt.Sprintf("  %-28s %-5s %4dx%-4d %s fps", p.Profile, p.Format, p.Width, p.Height, rate)
+			switch {
+			case !p.Supported:
+				line += ", format not supported"
+			case p.Test != nil && p.Test.Error != "":
+				line += ", test failed: " + p.Test.Error
+			case p.Test != nil:
+				line += fmt.Sprintf(", measured %.2f fps, %.1fms to decode", p.Test.FPS, p.Test.Decode)
+			}
+			fmt.Println(line)
 		}
 	},
 }
 
+// listProfiles is replaced in tests, which have no devices.
+var listProfiles = deviceProfiles
+
+// deviceProfiles lists the profiles of a device, capturing with each
+// supported one when test is set.
+func deviceProfiles(device string, test bool, frames int, mode string) ([]deviceProfile, error) {
+	path, err := video.Resolve(device)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := v4l.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	configs, err := stream.ListConfigs()
+	if err != nil {
+		return nil, err
+	}
+	if len(configs) == 0 {
+		return nil, errors.New("no supported profiles")
+	}
+
+	var profiles []deviceProfile
+	for _, cfg := range configs {
+		p := profileOf(cfg)
+		if test && p.Supported {
+			p.Test = testProfile(stream, p, frames, mode)
+		}
+		profiles = append(profiles, p)
+	}
+	return profiles, nil
+}
+
+// profileOf describes a device configuration.
+func profileOf(cfg v4l.DeviceConfig) deviceProfile {
+	format := decode.FormatName(cfg.Format)
+	_, err := decode.FourCC(format)
+	p := config.Profile{
+		Width:  cfg.Width,
+		Height: cfg.Height,
+		FPS:    int(cfg.FPS.N),
+		Per:    int(cfg.FPS.D),
+		Format: format,
+	}
+	return deviceProfile{
+		Profile:   p.String(),
+		Format:    format,
+		Width:     cfg.Width,
+		Height:    cfg.Height,
+		FPS:       p.Rate(),
+		Frames:    cfg.FPS.N,
+		Per:       cfg.FPS.D,
+		Supported: err == nil,
+	}
+}
+
+// testProfile captures frames with a profile, the first frame is
+// skipped as devices are often slow to start.
+func testProfile(dev *v4l.Device, p deviceProfile, frames int, mode string) *profileTest {
+	fail := func(err error) *profileTest {
+		return &profileTest{Error: err.Error()}
+	}
+
+	profile, err := config.ParseProfile(p.Profile)
+	if err != nil {
+		return fail(err)
+	}
+	dec, err := configureVideo(dev, profile, mode)
+	if err != nil {
+		return fail(err)
+	}
+	if err := dev.TurnOn(); err != nil {
+		return fail(err)
+	}
+	defer dev.TurnOff()
+
+	var start time.Time
+	var decoding time.Duration
+	for i := 0; i <= frames; i++ {
+		buf, err := dev.Capture()
+		if err != nil {
+			return fail(err)
+		}
+		if i == 0 {
+			start = time.Now()
+			continue
+		}
+		b := make([]byte, buf.Size())
+		buf.Read(b)
+
+		t := time.Now()
+		if _, err := dec(b); err != nil {
+			return fail(err)
+		}
+		decoding += time.Since(t)
+	}
+
+	return &profileTest{
+		FPS:    float64(frames) / time.Since(start).Seconds(),
+		Decode: decoding.Seconds() * 1000 / float64(frames),
+	}
+}
+
 func init() {
 	rootCmd.AddCommand(profilesCmd)
 
-	profilesCmd.Flags().StringP("device", "d", "/dev/video0", "Help message for toggle")
+	profilesCmd.Flags().StringP("device", "d", "/dev/video0", "Video device to list profiles for, a path, by-id name or card name")
+	profilesCmd.Flags().Bool("json", false, "Print the profiles as json")
+	profilesCmd.Flags().Bool("test", false, "Capture with each supported profile and report the fps and decode time")
+	profilesCmd.Flags().Int("frames", 10, "Number of frames to capture when testing")
+	profilesCmd.Flags().String("decode", decode.ModeFull, "Decode mode to test mjpeg profiles with, full or dc")
 }
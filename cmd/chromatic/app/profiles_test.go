@@ -0,0 +1,50 @@
+package app
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// run runs chromatic with args and a config file, returning what it
+// printed on stdout.
+func run(t *testing.T, args ...string) []byte {
+	dir, err := ioutil.TempDir("", "app")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "chromatic.yaml")
+	assert.NoError(t, ioutil.WriteFile(file, []byte("bind: \":8080\"\n"), 0600))
+
+	r, w, err := os.Pipe()
+	assert.NoError(t, err)
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	out := make(chan []byte)
+	go func() {
+		b, _ := ioutil.ReadAll(r)
+		out <- b
+	}()
+	rootCmd.SetArgs(append([]string{"--config", file}, args...))
+	err = rootCmd.Execute()
+	w.Close()
+	assert.NoError(t, err)
+	return <-out
+}
+
+func TestProfilesJSON(t *testing.T) {
+	defer func(list func(string, bool, int, string) ([]deviceProfile, error)) { listProfiles = list }(listProfiles)
+	listProfiles = func(device string, test bool, frames int, mode string) ([]deviceProfile, error) {
+		return []deviceProfile{{Profile: "1280x720@30", Format: "mjpeg", Width: 1280, Height: 720, FPS: 30, Frames: 30, Per: 1, Supported: true}}, nil
+	}
+
+	var profiles []deviceProfile
+	assert.NoError(t, json.Unmarshal(run(t, "profiles", "--json"), &profiles))
+	assert.Len(t, profiles, 1)
+	assert.Equal(t, "1280x720@30", profiles[0].Profile)
+}
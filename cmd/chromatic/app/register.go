@@ -25,26 +25,41 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/GetVivid/huego"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
+// linkButtonNotPressed is the hue api error type returned by CreateUser
+// until the link button on the bridge has been pressed.
+const linkButtonNotPressed = 101
+
 // registerCmd represents the register command
 var registerCmd = &cobra.Command{
 	Use:   "register",
 	Short: "Create a user on the philips hue bridge",
 	Run: func(cmd *cobra.Command, args []string) {
 		host, _ := cmd.Flags().GetString("host")
+		save, _ := cmd.Flags().GetBool("save")
+		timeout, _ := cmd.Flags().GetDuration("timeout")
 
 		bridge := huego.Bridge{
 			Host: host,
 		}
 
-		fmt.Println("Press the link button on the hub, then press enter...")
-		fmt.Scanln()
+		var user, clientkey string
+		var err error
+		if save {
+			fmt.Printf("Press the link button on the hub within %s...\n", timeout)
+			user, clientkey, err = waitForUser(&bridge, timeout)
+		} else {
+			fmt.Println("Press the link button on the hub, then press enter...")
+			fmt.Scanln()
 
-		user, clientkey, err := bridge.CreateUser("chromatic") // Link button needs to be pressed
+			user, clientkey, err = bridge.CreateUser("chromatic") // Link button needs to be pressed
+		}
 		if err != nil {
 			var e *huego.APIError
 			if errors.As(err, &e) {
@@ -55,15 +70,54 @@ var registerCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
-		fmt.Printf("Username: %s\n", user)
-		fmt.Printf("ClientKey: %s\n", clientkey)
+		if !save {
+			fmt.Printf("Username: %s\n", user)
+			fmt.Printf("ClientKey: %s\n", clientkey)
+			return
+		}
+
+		viper.Set("light.bridge", host)
+		viper.Set("light.username", user)
+		viper.Set("light.client_key", clientkey)
 
+		file, err := configPath()
+		if err == nil {
+			err = writeConfig(viper.GetViper(), file)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error saving config: %s\n", err.Error())
+			os.Exit(1)
+		}
+		fmt.Printf("Credentials saved to %s\n", file)
 	},
 }
 
+// waitForUser polls the bridge until the link button is pressed and a user
+// is created, or until the timeout expires.
+func waitForUser(bridge *huego.Bridge, timeout time.Duration) (string, string, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		user, clientkey, err := bridge.CreateUser("chromatic")
+		if err == nil {
+			return user, clientkey, nil
+		}
+
+		var e *huego.APIError
+		if !errors.As(err, &e) || e.Type != linkButtonNotPressed {
+			return "", "", err
+		}
+		if time.Now().After(deadline) {
+			return "", "", errors.New("timed out waiting for the link button")
+		}
+		time.Sleep(time.Second)
+	}
+}
+
 func init() {
 	rootCmd.AddCommand(registerCmd)
 
 	registerCmd.Flags().StringP("host", "a", "", "Philips Hue hub address")
+	registerCmd.Flags().BoolP("save", "s", false, "Save the credentials to the config file")
+	registerCmd.Flags().DurationP("timeout", "t", 30*time.Second, "How long to wait for the link button when saving")
 	registerCmd.MarkFlagRequired("host")
 }
@@ -22,18 +22,23 @@ THE SOFTWARE.
 package app
 
 import (
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path"
-	"regexp"
-	"strconv"
 
 	"github.com/GetVivid/huego"
 	"github.com/Khabi/chromatic/internal/api"
 	"github.com/Khabi/chromatic/internal/chromatic"
+	"github.com/Khabi/chromatic/internal/config"
+	"github.com/Khabi/chromatic/internal/decode"
+	"github.com/Khabi/chromatic/internal/hue"
 	"github.com/Khabi/chromatic/internal/location"
+	"github.com/Khabi/chromatic/internal/mqtt"
+	"github.com/Khabi/chromatic/internal/sink"
+	"github.com/Khabi/chromatic/internal/video"
 	"github.com/korandiz/v4l"
-	"github.com/korandiz/v4l/fmt/mjpeg"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 
@@ -43,6 +48,9 @@ import (
 
 var cfgFile string
 
+// configFound is set once a config file has been read in.
+var configFound bool
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "chromatic",
@@ -52,119 +60,284 @@ var rootCmd = &cobra.Command{
 	// has an action associated with it:
 	Run: func(cmd *cobra.Command, args []string) {
 
-		lvl, err := logrus.ParseLevel(viper.GetString("log_level"))
+		if !configFound {
+			fmt.Println("Missing config file!")
+			os.Exit(1)
+		}
+
+		conf, err := config.Load(viper.GetViper())
 		if err != nil {
-			logrus.Warn("invalid log level, setting to info")
-			lvl = logrus.InfoLevel
+			fmt.Fprintln(os.Stderr, "Invalid config:")
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(255)
+		}
+
+		lvl := logrus.InfoLevel
+		if conf.LogLevel != "" {
+			lvl, _ = logrus.ParseLevel(conf.LogLevel)
 		}
 		logrus.SetLevel(lvl)
+
 		commandChan := make(chan chromatic.State)
+		modeChan := make(chan chromatic.Mode)
 		statusChan := make(chan chromatic.ServerStatus)
 
-		// Configure the video device
-		if viper.GetString("video.device") == "" || viper.GetString("video.profile") == "" {
-			fmt.Fprintln(os.Stderr, "video input misconfigured")
-			os.Exit(255)
+		// Configure the video devices
+		var sources []chromatic.Source
+		for _, v := range conf.Videos() {
+			dev, dec, err := openVideo(v)
+			if err != nil {
+				fmt.Printf("%s: %s\n", v.Label(), err)
+				os.Exit(1)
+			}
+			// Reopen by a stable path, the device can come back with a
+			// different number.
+			reopen := v
+			reopen.Device = video.StablePath(v.Device)
+			sources = append(sources, chromatic.Source{
+				Name:    v.Label(),
+				Device:  v.Device,
+				Profile: v.Profile,
+				Video:   chromatic.V4L(dev),
+				Decode:  dec,
+				Open: func() (chromatic.Device, decode.Func, error) {
+					dev, dec, err := openVideo(reopen)
+					if err != nil {
+						return nil, nil, err
+					}
+					return chromatic.V4L(dev), dec, nil
+				},
+			})
 		}
 
-		video, err := v4l.Open(viper.GetString("video.device"))
-		if err != nil {
-			fmt.Println("Unable to open video device.")
-			os.Exit(1)
+		// Configure the lights
+		var client *mqtt.Client
+		if conf.MQTT.Broker != "" {
+			client = mqtt.New(conf.MQTT.Options(), commandChan, modeChan, statusChan)
+			go func() {
+				if err := client.Run(); err != nil {
+					logrus.WithError(err).Error("unable to connect to mqtt")
+				}
+			}()
 		}
 
-		cfg, err := video.GetConfig()
-		if err != nil {
-			fmt.Println("Video profile issues")
-			os.Exit(1)
+		var outputs []chromatic.Output
+		publishing := false
+		for _, light := range conf.Lights() {
+			o, err := output(light, client, sources[0].Name)
+			if err != nil {
+				fmt.Printf("%s: %s\n", light.Label(), err)
+				os.Exit(1)
+			}
+			o.Rate = conf.OutputRate(light)
+			outputs = append(outputs, o)
+			publishing = publishing || light.Type == "mqtt"
+		}
+
+		// Without an mqtt output, publish the colors of the first one.
+		if client != nil && !publishing {
+			outputs[0].Sink = client.Wrap(outputs[0].Sink)
 		}
 
-		cfg.Format = mjpeg.FourCC
+		// Exit once told to stop, over the api or mqtt, and the lights
+		// are handed back.
+		go api.Run(conf.API(), commandChan, modeChan, statusChan)
+		chromatic.Run(commandChan, modeChan, statusChan, sources, outputs, conf.Rate.Governor())
+	},
+}
 
-		re := regexp.MustCompile(`(?P<width>\d+)x(?P<height>\d+)@(?P<fps>\d+)`)
-		profile := re.FindStringSubmatch(viper.GetString("video.profile"))
+// openVideo opens a capture device, applies its profile and returns the
+// decoder for its frames.
+func openVideo(v config.Video) (*v4l.Device, decode.Func, error) {
+	path, err := video.Resolve(v.Device)
+	if err != nil {
+		return nil, nil, err
+	}
+	dev, err := v4l.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to open video device: %w", err)
+	}
 
-		width, err := strconv.Atoi(profile[1])
+	// Already checked by config validation.
+	profile, _ := config.ParseProfile(v.Profile)
+	dec, err := configureVideo(dev, profile, v.Decode)
+	if err != nil {
+		dev.Close()
+		return nil, nil, err
+	}
+	return dev, dec, nil
+}
+
+// configureVideo applies a profile to a capture device and returns the
+// decoder for its frames, mode is the decode mode for mjpeg frames.
+func configureVideo(dev *v4l.Device, profile config.Profile, mode string) (decode.Func, error) {
+	cfg, err := dev.GetConfig()
+	if err != nil {
+		return nil, fmt.Errorf("video profile issues: %w", err)
+	}
+
+	if cfg.Format, err = decode.FourCC(profile.Format); err != nil {
+		return nil, err
+	}
+	cfg.Width = profile.Width
+	cfg.Height = profile.Height
+	cfg.FPS = v4l.Frac{N: uint32(profile.FPS), D: uint32(profile.Per)}
+	if cfg.FPS.D == 0 {
+		cfg.FPS.D = 1
+	}
+	if err := dev.SetConfig(cfg); err != nil {
+		return nil, fmt.Errorf("invalid video configuration: %w", err)
+	}
+
+	if profile.Format == "" || profile.Format == decode.FormatMJPEG {
+		return decode.Parse(mode)
+	}
+
+	// The driver can adjust the size, and rows of raw frames can be
+	// padded.
+	if cfg, err = dev.GetConfig(); err != nil {
+		return nil, fmt.Errorf("video profile issues: %w", err)
+	}
+	info, err := dev.BufferInfo()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the frame layout: %w", err)
+	}
+	return decode.Raw(profile.Format, cfg.Width, cfg.Height, info.ImageStride)
+}
+
+// output creates the sink for a light and the bounds it samples from
+// each source, first is the source used when a region doesn't name one.
+func output(light config.Light, client *mqtt.Client, first string) (chromatic.Output, error) {
+	var out sink.Sink
+	var unbound location.Bounds
+	var group string
+	var err error
+	switch light.Type {
+	case "", "hue":
+		out, unbound, group, err = hueOutput(light)
+	case "hue_v2":
+		out, unbound, group, err = hueV2Output(light)
+	case "mqtt":
+		out = client.Sink()
+	default:
+		out, err = bindingOutput(light)
+	}
+	if err != nil {
+		return chromatic.Output{}, err
+	}
+
+	bounds, _ := light.SourceBounds(first) // Already checked by config validation.
+	bounds[first] = append(bounds[first], unbound...)
+	return chromatic.Output{
+		Name:   light.Label(),
+		Group:  group,
+		Sink:   out,
+		Bounds: bounds,
+	}, nil
+}
+
+// hueOutput finds the configured entertainment group, along with bounds
+// for its lights that don't have a binding and the group's name.
+func hueOutput(light config.Light) (sink.Sink, location.Bounds, string, error) {
+	bridge := huego.New(
+		light.Bridge,
+		light.Username,
+		light.ClientKey,
+	)
+
+	var group *huego.EntertainmentGroup
+	var err error
+	if light.GroupID != 0 {
+		group, err = bridge.GetEntertainmentGroup(light.GroupID)
 		if err != nil {
-			fmt.Println("invalid profile width")
-			os.Exit(1)
+			return nil, nil, "", err
 		}
-		height, err := strconv.Atoi(profile[2])
+	}
+	if light.GroupName != "" {
+		groups, err := bridge.GetEntertainmentGroups()
 		if err != nil {
-			fmt.Println("invalid profile height")
-			os.Exit(1)
+			return nil, nil, "", err
 		}
-		fps, err := strconv.Atoi(profile[3])
-		if err != nil {
-			fmt.Println("invalid profile fps")
-			os.Exit(1)
+		for _, g := range groups {
+			if g.Name == light.GroupName {
+				group = &g
+			}
 		}
-		cfg.Width = width
-		cfg.Height = height
-		cfg.FPS = v4l.Frac{uint32(fps), 1}
-		err = video.SetConfig(cfg)
+	}
+
+	if group == nil {
+		return nil, nil, "", errors.New("no matching entertainment group")
+	}
+
+	var bounds location.Bounds
+	for id, loc := range group.Locations {
+		bound, err := unboundHue(light, id, loc.X, loc.Y)
 		if err != nil {
-			fmt.Println(err)
-			fmt.Println("invalid video configuration")
-			os.Exit(1)
+			return nil, nil, "", err
 		}
+		bounds = append(bounds, bound...)
+	}
 
-		//Configure Hue
-		bridge := huego.New(
-			viper.GetString("light.bridge"),
-			viper.GetString("light.username"),
-			viper.GetString("light.client_key"),
-		)
-		var group *huego.EntertainmentGroup
-		if viper.GetInt("light.group_id") != 0 {
-			group, err = bridge.GetEntertainmentGroup(viper.GetInt("light.group_id"))
-			if err != nil {
-				fmt.Println(err)
-				os.Exit(1)
-			}
-		}
-		if viper.GetString("light.group_name") != "" {
-			groups, err := bridge.GetEntertainmentGroups()
-			if err != nil {
-				fmt.Println(err)
-				os.Exit(1)
-			}
-			for _, g := range groups {
-				if g.Name == viper.GetString("light.group_name") {
-					group = &g
-				}
-			}
-		}
+	return hue.NewEntertainment(bridge, group), bounds, group.Name, nil
+}
 
-		if group == nil {
-			fmt.Println("no matching entertainment group")
-			os.Exit(1)
-		}
+// hueV2Output finds the configured entertainment configuration, along
+// with bounds for its channels that don't have a binding.  Gradient
+// lights have a channel for each segment.  The name of the
+// configuration is returned too.
+func hueV2Output(light config.Light) (sink.Sink, location.Bounds, string, error) {
+	client, err := hue.NewClient(light.Bridge, light.Username)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	ent, err := client.EntertainmentConfiguration(light.Configuration)
+	if err != nil {
+		return nil, nil, "", err
+	}
 
-		// Get bounds for light sources
-		var bounds location.Bounds
-		for id, loc := range group.Locations {
-			preset := viper.GetString(fmt.Sprintf("light.binding.%d", id))
-			switch preset {
-			case "top":
-				bounds = append(bounds, location.Preset(id, location.Top))
-			case "left":
-				bounds = append(bounds, location.Preset(id, location.Left))
-			case "bottom":
-				bounds = append(bounds, location.Preset(id, location.Bottom))
-			case "right":
-				bounds = append(bounds, location.Preset(id, location.Right))
-			case "whole":
-				bounds = append(bounds, location.Preset(id, location.Whole))
-			default:
-				bounds = append(bounds, location.Bound{ID: id, X: loc.X, Y: loc.Y, Width: 5, Height: 5})
-			}
+	var bounds location.Bounds
+	for _, channel := range ent.Channels {
+		bound, err := unboundHue(light, channel.ID, channel.Position.X, channel.Position.Y)
+		if err != nil {
+			return nil, nil, "", err
 		}
+		bounds = append(bounds, bound...)
+	}
 
-		go chromatic.Run(commandChan, statusChan, video, group, bounds)
+	out, err := hue.NewEntertainmentV2(client, *ent, light.ClientKey)
+	return out, bounds, ent.Name(), err
+}
 
-		api.Run(viper.GetString("bind"), commandChan, statusChan)
-	},
+// unboundHue returns a bound around a hue light or channel's location in
+// the room when it doesn't have a binding.
+func unboundHue(light config.Light, id int, x, y float64) (location.Bounds, error) {
+	if _, ok := light.Binding[id]; ok {
+		return nil, nil
+	}
+
+	b := location.Bound{ID: id, X: x, Y: y, Width: 5, Height: 5}
+	if err := b.Validate(); err != nil {
+		return nil, fmt.Errorf("light %d has no binding and its hue location is unusable: %w", id, err)
+	}
+	return location.Bounds{b}, nil
+}
+
+// bindingOutput creates the sink for addressable strips and hue lights
+// driven through the regular api.
+func bindingOutput(light config.Light) (sink.Sink, error) {
+	switch light.Type {
+	case "hue_rest":
+		return hue.NewREST(light.Bridge, light.Username, light.RequestRate(), light.TransitionTime())
+	case "ddp":
+		return sink.NewDDP(light.Address, light.Layout())
+	case "e131":
+		return sink.NewE131(light.Address, light.Universe, light.Layout())
+	case "wled":
+		return sink.NewWLED(light.Address, light.Layout())
+	case "adalight":
+		return sink.NewAdalight(light.Serial, light.BaudRate(), light.Order, light.Layout())
+	}
+	return nil, fmt.Errorf("unknown type %q", light.Type)
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
@@ -209,11 +382,55 @@ func initConfig() {
 		viper.SetConfigName("chromatic")
 	}
 
-	// If a config file is found, read it in.
+	// If a config file is found, read it in.  A missing file is only fatal
+	// for commands that need it, commands like register can create it.
 	err := viper.ReadInConfig()
 	if err != nil {
-		fmt.Println("Missing config file!")
+		var notFound viper.ConfigFileNotFoundError
+		if errors.As(err, &notFound) || os.IsNotExist(err) {
+			return
+		}
+		fmt.Fprintln(os.Stderr, "Invalid config file:", err)
 		os.Exit(1)
 	}
-	fmt.Println("Using config file:", viper.ConfigFileUsed())
+	configFound = true
+	// Not on stdout, commands like status --json print documents there.
+	logrus.WithField("file", viper.ConfigFileUsed()).Debug("using config file")
+}
+
+// configPath returns the active config file, or a path in the users config
+// directory if there isn't one yet.
+func configPath() (string, error) {
+	if file := viper.ConfigFileUsed(); file != "" {
+		return file, nil
+	}
+
+	home, err := homedir.Dir()
+	if err != nil {
+		return "", err
+	}
+	return path.Join(home, ".config", "chromatic.yaml"), nil
+}
+
+// writeConfig writes the settings in v to file.  The file can contain
+// hue credentials, so they are written to a new file only readable by
+// the owner which then replaces file.
+func writeConfig(v *viper.Viper, file string) error {
+	dir := path.Dir(file)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	// Keep the extension, viper picks the format from it.
+	tmp, err := ioutil.TempFile(dir, ".chromatic-*"+path.Ext(file))
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	if err := v.WriteConfigAs(tmp.Name()); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
 }
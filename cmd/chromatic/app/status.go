@@ -0,0 +1,123 @@
+/*
+Copyright © 2020 Richard Cox
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Khabi/chromatic/internal/api"
+	"github.com/Khabi/chromatic/internal/chromatic"
+	"github.com/spf13/cobra"
+)
+
+// statusCmd represents the status command
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the status of the running service",
+	Run: func(cmd *cobra.Command, args []string) {
+		asJSON, _ := cmd.Flags().GetBool("json")
+
+		status, err := apiClient(cmd, api.ScopeRead).Status()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		if asJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(status); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		}
+		printStatus(status)
+	},
+}
+
+func printStatus(s chromatic.ServerStatus) {
+	fmt.Printf("State:   %s, %s mode\n", s.State, s.Mode)
+	fmt.Printf("Uptime:  %s\n", time.Duration(s.Uptime)*time.Second)
+	rate := fmt.Sprintf("%d fps sampled, %d fps sent", s.FPS, s.OutputFPS)
+	if s.CaptureLimit > 0 {
+		rate += fmt.Sprintf(", capture limited to %.1f fps", s.CaptureLimit)
+	}
+	fmt.Printf("Rate:    %s\n", rate)
+	if s.LastError != nil {
+		fmt.Printf("Error:   %s (%s)\n", s.LastError.Message, s.LastError.Time.Local().Format(time.Stamp))
+	}
+
+	fmt.Println("\nSources:")
+	for _, src := range s.Sources {
+		fmt.Printf("  %s: %s %s\n", src.Name, src.Device, src.Profile)
+		if !src.Available {
+			fmt.Println("    unavailable, waiting for it to return")
+			continue
+		}
+		fmt.Printf("    %d of %d fps sampled, %.1fms latency\n", src.FPS, src.Captured, src.Latency)
+	}
+
+	fmt.Println("\nOutputs:")
+	for _, out := range s.Outputs {
+		name := out.Name
+		if out.Group != "" {
+			name += " (" + out.Group + ")"
+		}
+		fmt.Printf("  %s: %d fps\n", name, out.FPS)
+		if h := out.Health; h != nil {
+			state := "connected"
+			if !h.Connected {
+				state = "disconnected"
+			}
+			if h.Reason != "" {
+				state += ", last dropped: " + h.Reason
+			}
+			fmt.Printf("    %s, %d reconnects\n", state, h.Reconnects)
+		}
+		if len(out.Colors) == 0 {
+			continue
+		}
+		ids := make([]int, 0, len(out.Colors))
+		for id := range out.Colors {
+			ids = append(ids, id)
+		}
+		sort.Ints(ids)
+		colors := make([]string, len(ids))
+		for i, id := range ids {
+			colors[i] = fmt.Sprintf("%d %s", id, out.Colors[id])
+		}
+		fmt.Printf("    colors: %s\n", strings.Join(colors, ", "))
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+
+	addressFlag(statusCmd)
+	statusCmd.Flags().Bool("json", false, "Print the status as json")
+}
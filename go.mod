@@ -5,21 +5,25 @@ go 1.14
 require (
 	github.com/GetVivid/huego v0.0.0-00010101000000-000000000000
 	github.com/bugra/kmeans v0.0.0-20140831011822-bf06fda928a7
+	github.com/eclipse/paho.mqtt.golang v1.3.0
 	github.com/gorilla/mux v1.8.0
 	github.com/korandiz/v4l v0.0.0-20180520170035-995f703bfc89
 	github.com/lucasb-eyer/go-colorful v1.0.3
 	github.com/mash/gokmeans v0.0.0-20170215130432-ea22cff45f59
 	github.com/mattn/go-sqlite3 v1.14.4
 	github.com/mitchellh/go-homedir v1.1.0
+	github.com/mitchellh/mapstructure v1.1.2
 	github.com/mpraski/clusters v0.0.0-20171016094157-18104487c312
 	github.com/muesli/clusters v0.0.0-20200529215643-2700303c1762
 	github.com/muesli/kmeans v0.0.0-20200718051629-66f1657148c0
 	github.com/nfnt/resize v0.0.0-20180221191011-83c6a9932646
 	github.com/paulbellamy/ratecounter v0.2.0
+	github.com/pion/dtls/v2 v2.0.4
 	github.com/sirupsen/logrus v1.2.0
 	github.com/spf13/cobra v1.0.0
 	github.com/spf13/viper v1.7.1
 	github.com/stretchr/testify v1.6.1
+	golang.org/x/sys v0.0.0-20200930185726-fdedc70b468f
 	gonum.org/v1/gonum v0.8.1 // indirect
 )
 
@@ -1,37 +1,150 @@
 package api
 
 import (
+	"crypto/tls"
 	"encoding/json"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/user"
+	"strconv"
 	"time"
 
 	"github.com/Khabi/chromatic/internal/chromatic"
 	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
 )
 
+// Options configures where the api listens and who can use it.
+type Options struct {
+	Bind        string      // tcp address, not served when empty
+	Socket      string      // unix socket path, not served when empty
+	SocketMode  os.FileMode // permissions of the socket, 0660 when 0
+	SocketGroup string      // group that owns the socket, the user's group when empty
+
+	// Only the tcp address is limited by these, the socket has its
+	// permissions.
+	Tokens     []Token      // when set every request needs one
+	Allow      []*net.IPNet // clients allowed to connect, any when empty
+	Cert       string       // tls certificate and key files
+	Key        string
+	SelfSigned bool // serve tls with a generated certificate, kept in Cert and Key when set
+}
+
+// TLS reports whether the tcp address is served over tls.
+func (o Options) TLS() bool {
+	return o.Cert != "" || o.SelfSigned
+}
+
 type service struct {
 	command chan chromatic.State
+	modes   chan chromatic.Mode
 	status  chan chromatic.ServerStatus
 }
 
-func Run(bind string, command chan chromatic.State, status chan chromatic.ServerStatus) {
+// Run serves the api on the tcp address and the unix socket.
+func Run(opts Options, command chan chromatic.State, modes chan chromatic.Mode, status chan chromatic.ServerStatus) {
 	s := service{
 		command: command,
+		modes:   modes,
 		status:  status,
 	}
 
-	r := mux.NewRouter()
-	r.HandleFunc("/action/{key}", s.Action)
-	r.HandleFunc("/status", s.Status)
-	srv := &http.Server{
-		Handler:      r,
-		Addr:         bind,
+	var servers []*http.Server
+	var listeners []net.Listener
+	if opts.Bind != "" {
+		ln, err := net.Listen("tcp", opts.Bind)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if opts.TLS() {
+			cfg, err := tlsConfig(opts)
+			if err != nil {
+				log.Fatal(err)
+			}
+			ln = tls.NewListener(ln, cfg)
+		} else if len(opts.Tokens) > 0 {
+			logrus.Warn("api tokens are sent in the clear, set up tls to protect them")
+		}
+		servers = append(servers, server(allow(opts.Allow, s.router(opts.Tokens))))
+		listeners = append(listeners, ln)
+	}
+	if opts.Socket != "" {
+		ln, err := listenSocket(opts.Socket, opts.SocketMode, opts.SocketGroup)
+		if err != nil {
+			log.Fatal(err)
+		}
+		servers = append(servers, server(s.router(nil)))
+		listeners = append(listeners, ln)
+	}
+
+	errs := make(chan error, len(listeners))
+	for i, ln := range listeners {
+		go func(srv *http.Server, ln net.Listener) { errs <- srv.Serve(ln) }(servers[i], ln)
+	}
+	log.Fatal(<-errs)
+}
+
+func server(h http.Handler) *http.Server {
+	return &http.Server{
+		Handler:      h,
 		WriteTimeout: 15 * time.Second,
 		ReadTimeout:  15 * time.Second,
 	}
+}
 
-	log.Fatal(srv.ListenAndServe())
+// listenSocket listens on a unix socket, replacing one left behind by a
+// previous run.
+func listenSocket(path string, mode os.FileMode, group string) (net.Listener, error) {
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and isn't a socket", path)
+		}
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s is in use, is chromatic already running?", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if mode == 0 {
+		mode = 0660
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	if group != "" {
+		g, err := user.LookupGroup(group)
+		if err != nil {
+			ln.Close()
+			return nil, err
+		}
+		gid, _ := strconv.Atoi(g.Gid)
+		if err := os.Chown(path, -1, gid); err != nil {
+			ln.Close()
+			return nil, err
+		}
+	}
+	return ln, nil
+}
+
+// router serves the api, requests need one of tokens when there are
+// any.
+func (s service) router(tokens []Token) *mux.Router {
+	r := mux.NewRouter()
+	r.Handle("/action/{key}", auth(tokens, ScopeControl, s.Action))
+	r.Handle("/mode/{name}", auth(tokens, ScopeControl, s.Mode))
+	r.Handle("/status", auth(tokens, ScopeRead, s.Status))
+	return r
 }
 
 func (s service) Action(w http.ResponseWriter, r *http.Request) {
@@ -43,16 +156,32 @@ func (s service) Action(w http.ResponseWriter, r *http.Request) {
 	case "pause":
 		s.command <- chromatic.Paused
 	case "stop":
+		// Answer first, the service exits once it has stopped.
+		w.WriteHeader(http.StatusOK)
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
 		s.command <- chromatic.Stop
+	default:
+		http.Error(w, fmt.Sprintf("unknown action %q, expected start, pause or stop", vars["key"]), http.StatusNotFound)
+	}
+}
+
+func (s service) Mode(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	mode, err := chromatic.ParseMode(vars["name"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
+	s.modes <- mode
 }
 
 func (s service) Status(w http.ResponseWriter, r *http.Request) {
 	s.command <- chromatic.Status
 	status := <-s.status
 
-	resp := make(map[string]interface{})
-	resp["state"] = status.State
-	resp["fps"] = status.FPS
+	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(status)
 }
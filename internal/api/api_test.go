@@ -0,0 +1,131 @@
+package api
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Khabi/chromatic/internal/chromatic"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestURL(t *testing.T) {
+	var tests = []struct {
+		bind     string
+		expected string
+	}{
+		{":8080", "http://localhost:8080"},
+		{"0.0.0.0:8080", "http://localhost:8080"},
+		{"[::]:8080", "http://localhost:8080"},
+		{"192.168.1.5:80", "http://192.168.1.5:80"},
+		{"chromatic.lan:8080", "http://chromatic.lan:8080"},
+	}
+
+	for _, td := range tests {
+		assert.Equal(t, td.expected, URL(td.bind, false), td.bind)
+	}
+	assert.Equal(t, "https://localhost:8080", URL(":8080", true))
+}
+
+func TestStatus(t *testing.T) {
+	command := make(chan chromatic.State)
+	status := make(chan chromatic.ServerStatus)
+	go func() {
+		for cmd := range command {
+			if cmd == chromatic.Status {
+				status <- chromatic.ServerStatus{
+					State:   "running",
+					Mode:    "average",
+					Outputs: []chromatic.OutputStatus{{Name: "hue", Colors: map[int]string{1: "#ff0000"}}},
+				}
+			}
+		}
+	}()
+	defer close(command)
+
+	server := httptest.NewServer(service{command: command, status: status}.router(nil))
+	defer server.Close()
+
+	got, err := client(t, server.URL, ClientOptions{}).Status()
+	assert.NoError(t, err)
+	assert.Equal(t, "running", got.State)
+	assert.Equal(t, map[int]string{1: "#ff0000"}, got.Outputs[0].Colors)
+
+	server.Close()
+	_, err = client(t, server.URL, ClientOptions{}).Status()
+	assert.Contains(t, err.Error(), "is it running?")
+}
+
+func TestCommands(t *testing.T) {
+	command := make(chan chromatic.State, 1)
+	modes := make(chan chromatic.Mode, 1)
+	server := httptest.NewServer(service{command: command, modes: modes}.router(nil))
+	defer server.Close()
+	c := client(t, server.URL, ClientOptions{})
+
+	var tests = []struct {
+		send     func() error
+		expected chromatic.State
+	}{
+		{c.Start, chromatic.Running},
+		{c.Pause, chromatic.Paused},
+		{c.Stop, chromatic.Stop},
+	}
+	for _, td := range tests {
+		assert.NoError(t, td.send())
+		assert.Equal(t, td.expected, <-command)
+	}
+
+	assert.NoError(t, c.Mode("prominent"))
+	assert.Equal(t, chromatic.Prominent, <-modes)
+	assert.EqualError(t, c.Mode("loud"), `unknown mode "loud", expected average or prominent`)
+	assert.EqualError(t, c.post("/action/restart"), `unknown action "restart", expected start, pause or stop`)
+}
+
+func TestSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "api")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "chromatic.sock")
+
+	// A socket left behind by a previous run is replaced.
+	stale, err := net.Listen("unix", path)
+	assert.NoError(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	ln, err := listenSocket(path, 0600, "")
+	assert.NoError(t, err)
+	defer ln.Close()
+	fi, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+
+	_, err = listenSocket(path, 0, "")
+	assert.EqualError(t, err, path+" is in use, is chromatic already running?")
+
+	command := make(chan chromatic.State, 1)
+	go (&http.Server{Handler: service{command: command}.router(nil)}).Serve(ln)
+	assert.NoError(t, client(t, path, ClientOptions{}).Pause())
+	assert.Equal(t, chromatic.Paused, <-command)
+	assert.NoError(t, client(t, "unix:"+path, ClientOptions{}).Start())
+	assert.Equal(t, chromatic.Running, <-command)
+
+	_, err = client(t, path+".missing", ClientOptions{}).Status()
+	assert.Contains(t, err.Error(), "unable to reach chromatic at "+path+".missing")
+
+	file := filepath.Join(dir, "file")
+	assert.NoError(t, ioutil.WriteFile(file, nil, 0644))
+	_, err = listenSocket(file, 0, "")
+	assert.EqualError(t, err, file+" exists and isn't a socket")
+}
+
+func client(t *testing.T, address string, opts ClientOptions) *Client {
+	c, err := NewClient(address, opts)
+	assert.NoError(t, err)
+	return c
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Scopes limit what a token can do.
+const (
+	ScopeRead    = "read"    // only the status
+	ScopeControl = "control" // everything
+)
+
+// Token is a secret a client sends as a bearer token or X-API-Key
+// header.
+type Token struct {
+	Value string
+	Scope string
+}
+
+// can reports whether the token is allowed what scope allows.
+func (t Token) can(scope string) bool {
+	return t.Scope == ScopeControl || t.Scope == scope
+}
+
+// auth checks a request has a token for scope before passing it to h.
+// Without tokens every request is passed on.
+func auth(tokens []Token, scope string, h http.HandlerFunc) http.Handler {
+	if len(tokens) == 0 {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secret := r.Header.Get("X-API-Key")
+		if bearer := r.Header.Get("Authorization"); strings.HasPrefix(bearer, "Bearer ") {
+			secret = strings.TrimPrefix(bearer, "Bearer ")
+		}
+		if secret == "" {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "a token is required", http.StatusUnauthorized)
+			return
+		}
+
+		token, ok := find(tokens, secret)
+		switch {
+		case !ok:
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			http.Error(w, "unknown token", http.StatusUnauthorized)
+		case !token.can(scope):
+			http.Error(w, "token can only read the status", http.StatusForbidden)
+		default:
+			h(w, r)
+		}
+	})
+}
+
+// find looks up a secret, comparing every token in constant time.
+func find(tokens []Token, secret string) (Token, bool) {
+	var found Token
+	ok := false
+	for _, t := range tokens {
+		if subtle.ConstantTimeCompare([]byte(t.Value), []byte(secret)) == 1 {
+			found, ok = t, true
+		}
+	}
+	return found, ok
+}
+
+// allow only passes on requests from clients in nets, any client when
+// there are none.
+func allow(nets []*net.IPNet, h http.Handler) http.Handler {
+	if len(nets) == 0 {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		ip := net.ParseIP(host)
+		for _, n := range nets {
+			if ip != nil && n.Contains(ip) {
+				h.ServeHTTP(w, r)
+				return
+			}
+		}
+		http.Error(w, "client is not allowed", http.StatusForbidden)
+	})
+}
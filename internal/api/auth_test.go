@@ -0,0 +1,73 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuth(t *testing.T) {
+	tokens := []Token{{Value: "reader", Scope: ScopeRead}, {Value: "admin", Scope: ScopeControl}}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	var tests = []struct {
+		name     string
+		tokens   []Token
+		scope    string
+		header   string
+		value    string
+		expected int
+		body     string
+	}{
+		{"no tokens", nil, ScopeControl, "", "", http.StatusOK, ""},
+		{"missing", tokens, ScopeRead, "", "", http.StatusUnauthorized, "a token is required"},
+		{"unknown", tokens, ScopeRead, "Authorization", "Bearer nobody", http.StatusUnauthorized, "unknown token"},
+		{"read", tokens, ScopeRead, "Authorization", "Bearer reader", http.StatusOK, ""},
+		{"read control", tokens, ScopeControl, "Authorization", "Bearer reader", http.StatusForbidden, "token can only read the status"},
+		{"control", tokens, ScopeControl, "Authorization", "Bearer admin", http.StatusOK, ""},
+		{"control read", tokens, ScopeRead, "X-API-Key", "admin", http.StatusOK, ""},
+		{"basic", tokens, ScopeRead, "Authorization", "Basic admin", http.StatusUnauthorized, "a token is required"},
+	}
+
+	for _, td := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/status", nil)
+		if td.header != "" {
+			r.Header.Set(td.header, td.value)
+		}
+		w := httptest.NewRecorder()
+		auth(td.tokens, td.scope, ok).ServeHTTP(w, r)
+		assert.Equal(t, td.expected, w.Code, td.name)
+		assert.Equal(t, td.body, strings.TrimSpace(w.Body.String()), td.name)
+	}
+}
+
+func TestAllow(t *testing.T) {
+	_, lan, _ := net.ParseCIDR("192.168.1.0/24")
+	_, local, _ := net.ParseCIDR("::1/128")
+	nets := []*net.IPNet{lan, local}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	var tests = []struct {
+		nets     []*net.IPNet
+		remote   string
+		expected int
+	}{
+		{nil, "10.0.0.1:1234", http.StatusOK},
+		{nets, "192.168.1.20:1234", http.StatusOK},
+		{nets, "[::1]:1234", http.StatusOK},
+		{nets, "192.168.2.20:1234", http.StatusForbidden},
+		{nets, "bogus", http.StatusForbidden},
+	}
+
+	for _, td := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/status", nil)
+		r.RemoteAddr = td.remote
+		w := httptest.NewRecorder()
+		allow(td.nets, ok).ServeHTTP(w, r)
+		assert.Equal(t, td.expected, w.Code, td.remote)
+	}
+}
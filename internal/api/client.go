@@ -0,0 +1,166 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Khabi/chromatic/internal/chromatic"
+)
+
+// Client talks to the api of a running chromatic.
+type Client struct {
+	address string // where the api is, for errors
+	url     string // base url of the api
+	token   string
+	client  *http.Client
+}
+
+// ClientOptions get a client past the api's auth and tls.
+type ClientOptions struct {
+	Token    string
+	CA       string // pem file of a certificate to trust, like a self signed one
+	Insecure bool   // don't verify the api's certificate
+}
+
+// NewClient creates a client for the api at address, a url like
+// http://localhost:8080 or the path of a unix socket.
+func NewClient(address string, opts ClientOptions) (*Client, error) {
+	c := &Client{
+		address: address,
+		url:     strings.TrimSuffix(address, "/"),
+		token:   opts.Token,
+	}
+
+	transport := &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: opts.Insecure}}
+	if opts.CA != "" {
+		pem, err := ioutil.ReadFile(opts.CA)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", opts.CA)
+		}
+		transport.TLSClientConfig.RootCAs = pool
+	}
+
+	path := strings.TrimPrefix(address, "unix:")
+	if strings.HasPrefix(path, "/") {
+		c.url = "http://chromatic" // the host is ignored
+		var dialer net.Dialer
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", path)
+		}
+	}
+	c.client = &http.Client{Timeout: 5 * time.Second, Transport: transport}
+	return c, nil
+}
+
+// URL is where a client reaches an api listening on bind.  Addresses
+// that listen on every interface are reached on localhost.
+func URL(bind string, secure bool) string {
+	scheme := "http://"
+	if secure {
+		scheme = "https://"
+	}
+	host, port, err := net.SplitHostPort(bind)
+	if err != nil {
+		return scheme + bind
+	}
+	if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+		host = "localhost"
+	}
+	return scheme + net.JoinHostPort(host, port)
+}
+
+// Start starts capturing.
+func (c *Client) Start() error {
+	return c.post("/action/start")
+}
+
+// Pause stops capturing until the next start.
+func (c *Client) Pause() error {
+	return c.post("/action/pause")
+}
+
+// Stop stops the service.
+func (c *Client) Stop() error {
+	return c.post("/action/stop")
+}
+
+// Mode switches how colors are picked, like average or prominent.
+func (c *Client) Mode(name string) error {
+	return c.post("/mode/" + url.PathEscape(name))
+}
+
+// post sends a command, errors in the body are passed on.
+func (c *Client) post(path string) error {
+	resp, err := c.do(http.MethodPost, path)
+	if err != nil {
+		return c.unreachable(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return c.failed(resp)
+	}
+	return nil
+}
+
+// failed turns a response that isn't ok into an error, the body has the
+// reason.
+func (c *Client) failed(resp *http.Response) error {
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	if msg := strings.TrimSpace(string(body)); msg != "" {
+		return errors.New(msg)
+	}
+	return fmt.Errorf("chromatic at %s answered %s", c.address, resp.Status)
+}
+
+func (c *Client) do(method, path string) (*http.Response, error) {
+	req, err := http.NewRequest(method, c.url+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return c.client.Do(req)
+}
+
+func (c *Client) unreachable(err error) error {
+	var untrusted x509.UnknownAuthorityError
+	if errors.As(err, &untrusted) {
+		return fmt.Errorf("chromatic at %s has a certificate that isn't trusted: %w", c.address, err)
+	}
+	return fmt.Errorf("unable to reach chromatic at %s, is it running? %w", c.address, err)
+}
+
+// Status fetches the status of the capture loop.
+func (c *Client) Status() (chromatic.ServerStatus, error) {
+	var status chromatic.ServerStatus
+	resp, err := c.do(http.MethodGet, "/status")
+	if err != nil {
+		return status, c.unreachable(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return status, c.failed(resp)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return status, fmt.Errorf("unable to read the status: %w", err)
+	}
+	return status, nil
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Khabi/chromatic/internal/chromatic"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelfSigned(t *testing.T) {
+	now := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+	cert, _, err := selfSigned([]string{"localhost", "127.0.0.1", "chromatic.lan"}, now)
+	assert.NoError(t, err)
+
+	block, _ := pem.Decode(cert)
+	parsed, err := x509.ParseCertificate(block.Bytes)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"localhost", "chromatic.lan"}, parsed.DNSNames)
+	assert.Len(t, parsed.IPAddresses, 1)
+	assert.True(t, parsed.NotAfter.After(now.AddDate(9, 0, 0)))
+}
+
+func TestTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "api")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	opts := Options{
+		Bind:       "127.0.0.1:0",
+		Cert:       filepath.Join(dir, "cert.pem"),
+		Key:        filepath.Join(dir, "key.pem"),
+		SelfSigned: true,
+		Tokens:     []Token{{Value: "secret", Scope: ScopeRead}},
+	}
+
+	cfg, err := tlsConfig(opts)
+	assert.NoError(t, err)
+	fi, err := os.Stat(opts.Key)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+
+	// The kept certificate is used again.
+	again, err := tlsConfig(opts)
+	assert.NoError(t, err)
+	assert.Equal(t, cfg.Certificates[0].Certificate, again.Certificates[0].Certificate)
+
+	status := make(chan chromatic.ServerStatus, 1)
+	command := make(chan chromatic.State, 1)
+	server := httptest.NewUnstartedServer(service{command: command, status: status}.router(opts.Tokens))
+	server.TLS = cfg
+	server.StartTLS()
+	defer server.Close()
+	status <- chromatic.ServerStatus{State: "running"}
+
+	_, err = client(t, server.URL, ClientOptions{Token: "secret"}).Status()
+	assert.Contains(t, err.Error(), "has a certificate that isn't trusted")
+
+	got, err := client(t, server.URL, ClientOptions{Token: "secret", CA: opts.Cert}).Status()
+	assert.NoError(t, err)
+	assert.Equal(t, "running", got.State)
+	assert.Equal(t, chromatic.Status, <-command)
+
+	assert.EqualError(t, client(t, server.URL, ClientOptions{Token: "secret", Insecure: true}).Pause(), "token can only read the status")
+
+	_, err = NewClient(server.URL, ClientOptions{CA: opts.Key})
+	assert.EqualError(t, err, "no certificates in "+opts.Key)
+
+	_, err = tlsConfig(Options{Cert: filepath.Join(dir, "missing.pem"), Key: opts.Key})
+	assert.Contains(t, err.Error(), "unable to load the api certificate")
+}
@@ -1,7 +1,6 @@
 package chromatic
 
 import (
-	"bytes"
 	"fmt"
 	"image"
 	"image/draw"
@@ -10,19 +9,15 @@ import (
 	"sync"
 	"time"
 
-	"github.com/GetVivid/huego"
 	"github.com/Khabi/chromatic/internal/extract"
 	"github.com/Khabi/chromatic/internal/location"
-	"github.com/korandiz/v4l"
 	"github.com/lucasb-eyer/go-colorful"
-	"github.com/paulbellamy/ratecounter"
+	"github.com/nfnt/resize"
 	"github.com/sirupsen/logrus"
 )
 
 type State int
 
-var fps *ratecounter.RateCounter
-
 const (
 	Running State = iota
 	Paused
@@ -30,44 +25,102 @@ const (
 	Status
 )
 
+var stateNames = [...]string{"running", "paused", "stopping", "status"}
+
 func (s State) String() string {
-	return [...]string{"running", "paused", "stoping"}[s]
+	if s < 0 || int(s) >= len(stateNames) {
+		return fmt.Sprintf("State(%d)", int(s))
+	}
+	return stateNames[s]
+}
+
+// Mode is how the color of each bound is picked.
+type Mode int
+
+const (
+	Average Mode = iota
+	Prominent
+)
+
+var modeNames = [...]string{"average", "prominent"}
+
+func (m Mode) String() string {
+	if m < 0 || int(m) >= len(modeNames) {
+		return fmt.Sprintf("Mode(%d)", int(m))
+	}
+	return modeNames[m]
 }
 
-type ServerStatus struct {
-	State string
-	FPS   int64
+// ParseMode returns the mode with the given name.
+func ParseMode(name string) (Mode, error) {
+	for m, n := range modeNames {
+		if n == name {
+			return Mode(m), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown mode %q, expected average or prominent", name)
 }
 
-func Run(command <-chan State, status chan ServerStatus, video *v4l.Device, hue *huego.EntertainmentGroup, bounds location.Bounds) {
-	fps = ratecounter.NewRateCounter(1 * time.Second)
+// Run captures from every source while running, sending colors to the
+// outputs, until it is told to stop.  gov limits how often sources are
+// sampled.
+func Run(command <-chan State, modes <-chan Mode, status chan ServerStatus, sources []Source, outputs []Output, g Governor) {
+	started := time.Now()
+	errs := &lastError{}
+	out := newFanout(outputs, errs)
+	gov := newGovernor(g)
+
+	var cpu cpuMeter
+	var adapt <-chan time.Time
+	if gov.Adaptive {
+		cpu.usage()
+		ticker := time.NewTicker(adaptEvery)
+		defer ticker.Stop()
+		adapt = ticker.C
+	}
 
-	var stream *huego.EntertainmentStream
-	defer stream.StopStream()
 	var state = Paused
-	var err error
+	var mode = newModeSwitch(Average)
+	var captures []*capture
+	stop := func() {
+		// Keep any reopened devices for the next start.
+		for i, c := range captures {
+			sources[i] = c.stop()
+		}
+		captures = nil
+		out.Stop()
+	}
+	defer stop()
+
 	for {
 		select {
 		case cmd := <-command:
 			switch cmd {
 			case Running:
+				if state == Running {
+					continue
+				}
 				state = Running
-				stream, err = hue.StartStream()
-				if err != nil {
+				if err := out.Start(); err != nil {
 					logrus.WithError(err).Error("unable to capture")
 					os.Exit(1)
 				}
-				err = video.TurnOn()
-				if err != nil {
-					logrus.WithError(err).Error("unable to capture")
-					os.Exit(1)
+				for _, src := range sources {
+					c, err := startCapture(src, out, mode, gov, errs)
+					if err != nil {
+						logrus.WithError(err).WithField("source", src.Name).Error("unable to capture")
+						os.Exit(1)
+					}
+					captures = append(captures, c)
 				}
 				logrus.Info("starting capture")
 
 			case Paused:
+				if state == Paused {
+					continue
+				}
 				state = Paused
-				video.TurnOff()
-				stream.StopStream()
+				stop()
 				logrus.Info("pausing capture")
 			case Stop:
 				logrus.Info("stopping")
@@ -75,31 +128,32 @@ func Run(command <-chan State, status chan ServerStatus, video *v4l.Device, hue
 			case Status:
 				logrus.Info("fetching status")
 				status <- ServerStatus{
-					state.String(),
-					fps.Rate(),
+					State:        state.String(),
+					Mode:         mode.get().String(),
+					Uptime:       time.Since(started).Round(time.Second).Seconds(),
+					FPS:          rate(captures),
+					CaptureLimit: gov.fps(),
+					OutputFPS:    out.rate(),
+					LastError:    errs.get(),
+					Sources:      sourceStatus(sources, captures),
+					Outputs:      out.status(),
 				}
 			}
 
-		default:
-			if state == Running {
-				buf, _ := video.Capture()
-				b := make([]byte, buf.Size())
-				buf.Read(b)
-				img, _, err := image.Decode(bytes.NewReader(b))
-				if err != nil {
-					logrus.WithError(err).Error("unable to decode frame")
-				}
-				results := Get(img, bounds)
-				l := make(map[int][]float32)
-				for id, clr := range results {
-					c1, c2, c3 := clr.Xyy()
-					l[id] = []float32{float32(c1), float32(c2), float32(c3)}
-				}
-				fmt.Println(l)
-				stream.Set(l)
-
-				fps.Incr(1)
+		case <-adapt:
+			if state != Running {
+				continue
+			}
+			usage, err := cpu.usage()
+			if err != nil {
+				logrus.WithError(err).Debug("unable to read cpu usage")
+				continue
 			}
+			gov.adjust(usage, captureRate(captures))
+
+		case m := <-modes:
+			mode.set(m)
+			logrus.WithField("mode", m).Info("switching mode")
 		}
 	}
 }
@@ -109,30 +163,61 @@ type Processor struct {
 	Color colorful.Color
 }
 
-var wg sync.WaitGroup
+// integrals reuses summed-area tables between frames, they are large.
+var integrals = sync.Pool{
+	New: func() interface{} { return &extract.Integral{} },
+}
 
-func Get(frame image.Image, bounds location.Bounds) map[int]colorful.Color {
+// Get samples the color of each bound in frame.  Bounds that share an
+// ID are averaged together.  Prominent mode ignores polygon masks and
+// samples the whole rectangle around them.
+func Get(frame image.Image, bounds location.Bounds, mode Mode) map[int]colorful.Color {
 	res := map[int]colorful.Color{}
 
 	fb := frame.Bounds()
 	width := fb.Max.X
 	height := fb.Max.Y
 
+	// When the rectangles cover more than the frame it is cheaper to
+	// sum the frame once into a table than to sum each of them.
+	var table *extract.Integral
+	if mode == Average {
+		area := 0
+		for _, b := range bounds {
+			if len(b.Polygon) == 0 {
+				r := b.Rectangle(width, height)
+				area += r.Dx() * r.Dy()
+			}
+		}
+		if area > fb.Dx()*fb.Dy() {
+			table = integrals.Get().(*extract.Integral)
+			table.Reset(frame)
+			defer integrals.Put(table)
+		}
+	}
+
 	retChan := make(chan Processor, len(bounds))
 
+	var wg sync.WaitGroup
 	for _, b := range bounds {
 		wg.Add(1)
 		go func(bound location.Bound, frame image.Image, results chan Processor) {
 			defer wg.Done()
 			rect := bound.Rectangle(width, height)
-			section := image.NewRGBA(rect)
-			draw.Draw(section, rect, frame, rect.Min, draw.Src)
-
-			//m := resize.Resize(50, 0, section, resize.Lanczos3)
 
-			clr := extract.Average(section)
-			//r, g, z, a := clr.RGBA()
-			//fmt.Println(b.ID, r>>8, g>>8, z>>8, a>>8)
+			var clr colorful.Color
+			switch {
+			case mode == Prominent:
+				// kmeans is slow, keep the image small.
+				m := resize.Resize(50, 0, section(frame, rect), resize.Bilinear)
+				clr = extract.Prominent(m)
+			case len(bound.Polygon) > 0:
+				clr = extract.AverageMasked(frame, bound.Mask(width, height))
+			case table != nil:
+				clr = table.Average(rect)
+			default:
+				clr = extract.AverageRect(frame, rect)
+			}
 			res := Processor{
 				ID:    bound.ID,
 				Color: clr,
@@ -144,9 +229,27 @@ func Get(frame image.Image, bounds location.Bounds) map[int]colorful.Color {
 	wg.Wait()
 	close(retChan)
 
+	colors := map[int][]colorful.Color{}
 	for m := range retChan {
-		res[m.ID] = m.Color
+		colors[m.ID] = append(colors[m.ID], m.Color)
+	}
+	for id, c := range colors {
+		res[id] = extract.Mean(c...)
 	}
 
 	return res
 }
+
+// section returns the part of frame inside rect, sharing its pixels
+// when the image type allows it.
+func section(frame image.Image, rect image.Rectangle) image.Image {
+	if sub, ok := frame.(interface {
+		SubImage(image.Rectangle) image.Image
+	}); ok {
+		return sub.SubImage(rect)
+	}
+
+	s := image.NewRGBA(rect)
+	draw.Draw(s, rect, frame, rect.Min, draw.Src)
+	return s
+}
@@ -0,0 +1,95 @@
+package chromatic
+
+import (
+	"image"
+	"testing"
+
+	"github.com/Khabi/chromatic/internal/location"
+	"github.com/stretchr/testify/assert"
+)
+
+// testFrame is a 720p frame like a capture decodes to, with the colors
+// changing across it.
+func testFrame() image.Image {
+	img := image.NewYCbCr(image.Rect(0, 0, 1280, 720), image.YCbCrSubsampleRatio420)
+	for y := 0; y < 720; y++ {
+		for x := 0; x < 1280; x++ {
+			img.Y[img.YOffset(x, y)] = uint8(x * 255 / 1280)
+			img.Cb[img.COffset(x, y)] = uint8(y * 255 / 720)
+			img.Cr[img.COffset(x, y)] = uint8((x + y) % 256)
+		}
+	}
+	return img
+}
+
+// strip is 40 overlapping segments around the screen.
+func strip(tb testing.TB) location.Bounds {
+	bounds, err := location.Strip{Edge: location.Whole, Count: 40, Depth: 30, Start: location.TopLeft}.Bounds()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	for i := range bounds {
+		bounds[i].Width *= 3
+	}
+	return bounds
+}
+
+func TestStateString(t *testing.T) {
+	assert.Equal(t, "running", Running.String())
+	assert.Equal(t, "stopping", Stop.String())
+	assert.Equal(t, "status", Status.String())
+	assert.Equal(t, "State(7)", State(7).String())
+}
+
+func TestModeString(t *testing.T) {
+	assert.Equal(t, "prominent", Prominent.String())
+	assert.Equal(t, "Mode(-1)", Mode(-1).String())
+	assert.Equal(t, "Mode(2)", Mode(2).String())
+}
+
+func TestGet(t *testing.T) {
+	frame := testFrame()
+
+	// Few bounds are summed directly, many use a summed-area table, both
+	// get the same colors give or take rounding.
+	bounds := strip(t)
+	many := Get(frame, bounds, Average)
+	assert.Len(t, many, 40)
+	for _, b := range bounds[:4] {
+		few := Get(frame, location.Bounds{b}, Average)
+		assert.InDelta(t, few[b.ID].R, many[b.ID].R, 1.5/255)
+		assert.InDelta(t, few[b.ID].G, many[b.ID].G, 1.5/255)
+		assert.InDelta(t, few[b.ID].B, many[b.ID].B, 1.5/255)
+	}
+
+	// Polygons only average the pixels inside them.
+	triangle := location.Bound{ID: 1, Polygon: []location.Point{{X: -1, Y: 1}, {X: 1, Y: 1}, {X: -1, Y: -1}}}
+	box := location.Bound{ID: 1, X: 0, Y: 0, Width: 100, Height: 100}
+	assert.NotEqual(t, Get(frame, location.Bounds{box}, Average), Get(frame, location.Bounds{triangle}, Average))
+
+	assert.Len(t, Get(frame, location.Bounds{box}, Prominent), 1)
+}
+
+func BenchmarkGet(b *testing.B) {
+	frame := testFrame()
+	bounds := strip(b)
+
+	b.Run("average", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			Get(frame, bounds, Average)
+		}
+	})
+	b.Run("average few", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			Get(frame, bounds[:4], Average)
+		}
+	})
+	b.Run("prominent", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			Get(frame, bounds[:4], Prominent)
+		}
+	})
+}
@@ -0,0 +1,67 @@
+package chromatic
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// cpuMeter measures how busy every cpu is from /proc/stat.
+type cpuMeter struct {
+	busy, total uint64
+}
+
+// usage is the share of time the cpus were busy since it was last
+// called, or since boot the first time.
+func (m *cpuMeter) usage() (float64, error) {
+	f, err := os.Open("/proc/stat")
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil {
+		return 0, err
+	}
+	busy, total, err := parseStat(line)
+	if err != nil {
+		return 0, err
+	}
+
+	db, dt := busy-m.busy, total-m.total
+	m.busy, m.total = busy, total
+	if dt == 0 {
+		return 0, nil
+	}
+	return float64(db) / float64(dt), nil
+}
+
+// parseStat reads the busy and total time from the cpu line of
+// /proc/stat.  Waiting on io counts as idle.
+func parseStat(line string) (busy, total uint64, err error) {
+	fields := strings.Fields(line)
+	if len(fields) < 5 || fields[0] != "cpu" {
+		return 0, 0, errors.New("unexpected /proc/stat format")
+	}
+
+	// user nice system idle iowait irq softirq steal, guest time is
+	// already part of user.
+	var idle uint64
+	for i, f := range fields[1:] {
+		if i == 8 {
+			break
+		}
+		n, err := strconv.ParseUint(f, 10, 64)
+		if err != nil {
+			return 0, 0, err
+		}
+		total += n
+		if i == 3 || i == 4 {
+			idle += n
+		}
+	}
+	return total - idle, total, nil
+}
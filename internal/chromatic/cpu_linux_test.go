@@ -0,0 +1,21 @@
+package chromatic
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseStat(t *testing.T) {
+	busy, total, err := parseStat("cpu  100 20 30 800 50 5 5 0 40 0\n")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(160), busy)
+	assert.Equal(t, uint64(1010), total)
+
+	_, _, err = parseStat("intr 12345")
+	assert.EqualError(t, err, "unexpected /proc/stat format")
+
+	var m cpuMeter
+	_, err = m.usage()
+	assert.NoError(t, err)
+}
@@ -0,0 +1,111 @@
+package chromatic
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Governor limits how often frames from each source are sampled.  Frames
+// over the limit are dropped before they are decoded.
+type Governor struct {
+	FPS      float64 // frames sampled a second from each source, 0 samples every frame
+	Adaptive bool    // lower the rate while the cpu is busy
+	MaxCPU   float64 // share of the cpu adaptive mode keeps under, 0.8 when 0
+}
+
+const (
+	adaptEvery     = 2 * time.Second
+	minAdaptiveFPS = 5 // adaptive mode never goes below this
+)
+
+// governor holds the rate sampling is limited to, which adaptive mode
+// changes while captures read it.
+type governor struct {
+	Governor
+	limit uint64 // math.Float64bits of the frames a second, 0 is unlimited
+}
+
+func newGovernor(g Governor) *governor {
+	gov := &governor{Governor: g}
+	gov.set(g.FPS)
+	return gov
+}
+
+// fps is the current limit, 0 when there isn't one.
+func (g *governor) fps() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&g.limit))
+}
+
+func (g *governor) set(fps float64) {
+	atomic.StoreUint64(&g.limit, math.Float64bits(fps))
+}
+
+func (g *governor) maxCPU() float64 {
+	if g.MaxCPU == 0 {
+		return 0.8
+	}
+	return g.MaxCPU
+}
+
+// due reports whether a frame captured at now should be sampled.  next
+// is when the source may sample again, it is kept by the caller.
+func (g *governor) due(next *time.Time, now time.Time) bool {
+	fps := g.fps()
+	if fps <= 0 {
+		return true
+	}
+	if now.Before(*next) {
+		return false
+	}
+
+	// Step from the last due time so a device slightly faster than the
+	// limit averages out to it, unless the source fell behind.
+	interval := time.Duration(float64(time.Second) / fps)
+	if now.Sub(*next) > interval {
+		*next = now
+	}
+	*next = next.Add(interval)
+	return true
+}
+
+// adjust lowers the limit by a fifth while usage is over MaxCPU, and
+// raises it by a tenth once usage is well under until it is back to
+// FPS.  ceiling is how fast the sources capture, the most there is to
+// sample when FPS is 0.
+func (g *governor) adjust(usage, ceiling float64) {
+	top := g.FPS
+	if top == 0 {
+		top = ceiling
+	}
+	if top <= 0 {
+		return
+	}
+	current := g.fps()
+	limit := current
+	if limit == 0 || limit > top {
+		limit = top
+	}
+
+	log := logrus.WithField("cpu", math.Round(usage*100))
+	switch {
+	case usage > g.maxCPU():
+		next := math.Min(math.Max(limit*0.8, minAdaptiveFPS), limit)
+		if next == current {
+			return
+		}
+		g.set(next)
+		log.WithField("fps", math.Round(next)).Info("cpu is busy, lowering the capture rate")
+	case usage < g.maxCPU()-0.15 && current != g.FPS:
+		next := math.Max(limit*1.1, limit+1)
+		if next >= top {
+			g.set(g.FPS)
+			log.Info("capture rate is back to normal")
+			return
+		}
+		g.set(next)
+		log.WithField("fps", math.Round(next)).Debug("raising the capture rate")
+	}
+}
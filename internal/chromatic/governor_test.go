@@ -0,0 +1,69 @@
+package chromatic
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDue(t *testing.T) {
+	var tests = []struct {
+		name     string
+		limit    float64
+		every    time.Duration // time between frames
+		expected int           // frames sampled in a second
+	}{
+		{"unlimited", 0, time.Second / 30, 30},
+		{"half", 15, time.Second / 30, 15},
+		{"slightly slower", 25, time.Second / 30, 25},
+		{"under the limit", 60, time.Second / 30, 30},
+	}
+
+	for _, td := range tests {
+		t.Run(td.name, func(t *testing.T) {
+			g := newGovernor(Governor{FPS: td.limit})
+			var next time.Time
+			start := time.Now()
+			sampled := 0
+			for now := start; now.Sub(start) < time.Second; now = now.Add(td.every) {
+				if g.due(&next, now) {
+					sampled++
+				}
+			}
+			assert.InDelta(t, td.expected, sampled, 1)
+		})
+	}
+}
+
+func TestAdjust(t *testing.T) {
+	var tests = []struct {
+		name     string
+		gov      Governor
+		limit    float64 // current limit
+		usage    float64
+		ceiling  float64
+		expected float64
+	}{
+		{"busy unlimited", Governor{}, 0, 0.95, 30, 24},
+		{"busy limited", Governor{FPS: 20}, 20, 0.95, 30, 16},
+		{"busy minimum", Governor{}, 5, 0.95, 30, 5},
+		{"busy custom", Governor{MaxCPU: 0.5}, 0, 0.6, 30, 24},
+		{"steady", Governor{}, 16, 0.75, 30, 16},
+		{"idle", Governor{}, 16, 0.3, 30, 17.6},
+		{"idle slow", Governor{}, 5, 0.3, 30, 6},
+		{"recovered", Governor{}, 28, 0.3, 30, 0},
+		{"recovered limited", Governor{FPS: 20}, 19, 0.3, 30, 20},
+		{"unlimited idle", Governor{}, 0, 0.3, 30, 0},
+		{"no frames", Governor{}, 0, 0.95, 0, 0},
+	}
+
+	for _, td := range tests {
+		t.Run(td.name, func(t *testing.T) {
+			g := newGovernor(td.gov)
+			g.set(td.limit)
+			g.adjust(td.usage, td.ceiling)
+			assert.InDelta(t, td.expected, g.fps(), 0.001)
+		})
+	}
+}
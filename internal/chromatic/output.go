@@ -0,0 +1,307 @@
+package chromatic
+
+import (
+	"errors"
+	"image"
+	"sync"
+	"time"
+
+	"github.com/Khabi/chromatic/internal/extract"
+	"github.com/Khabi/chromatic/internal/location"
+	"github.com/Khabi/chromatic/internal/sink"
+	"github.com/lucasb-eyer/go-colorful"
+	"github.com/paulbellamy/ratecounter"
+	"github.com/sirupsen/logrus"
+)
+
+// Output is a sink and the bounds sampled for it from each source.
+// Bound IDs are the sink's channels, so every output has its own.
+type Output struct {
+	Name   string
+	Group  string // hue entertainment group or configuration, for status
+	Sink   sink.Sink
+	Bounds map[string]location.Bounds // keyed by source name
+	Rate   float64                    // colors sent a second, 0 sends each frame as it is sampled
+}
+
+// fanout sends colors to every output from its own goroutine, so a
+// slow or failing sink only drops its own frames.
+type fanout struct {
+	workers []*worker
+}
+
+type worker struct {
+	Output
+	log     *logrus.Entry
+	sent    *ratecounter.RateCounter
+	started bool
+	frames  chan map[int]colorful.Color // holds the latest unsent colors
+	done    chan struct{}
+	lastErr string
+
+	errs *lastError
+
+	mu     sync.Mutex
+	latest map[string]map[int]colorful.Color // latest colors from each source
+	last   map[int]colorful.Color            // colors last sent
+}
+
+func newFanout(outputs []Output, errs *lastError) *fanout {
+	f := &fanout{}
+	for _, o := range outputs {
+		f.workers = append(f.workers, &worker{
+			Output: o,
+			log:    logrus.WithField("output", o.Name),
+			sent:   ratecounter.NewRateCounter(1 * time.Second),
+			errs:   errs,
+		})
+	}
+	return f
+}
+
+// Start starts every sink at the same time, outputs that fail are
+// skipped until the next start.  It only fails when every output does.
+func (f *fanout) Start() error {
+	var wg sync.WaitGroup
+	for _, w := range f.workers {
+		if w.started {
+			continue
+		}
+		wg.Add(1)
+		go func(w *worker) {
+			defer wg.Done()
+			if err := w.Sink.Start(); err != nil {
+				w.log.WithError(err).Error("unable to start output")
+				w.errs.set(err)
+				return
+			}
+			w.started = true
+			w.latest = make(map[string]map[int]colorful.Color)
+			w.frames = make(chan map[int]colorful.Color, 1)
+			w.done = make(chan struct{})
+			if w.Rate > 0 {
+				go w.pace()
+			} else {
+				go w.run()
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	for _, w := range f.workers {
+		if w.started {
+			return nil
+		}
+	}
+	return errors.New("no outputs could be started")
+}
+
+// Set samples a frame from source for each output and hands the colors,
+// merged with the latest from its other sources, to the output's worker.
+func (f *fanout) Set(source string, frame image.Image, mode Mode) {
+	for _, w := range f.workers {
+		bounds, ok := w.Bounds[source]
+		if !w.started || !ok {
+			continue
+		}
+		results := Get(frame, bounds, mode)
+		w.log.WithField("source", source).Debug(results)
+		dropOldestColors(w.frames, w.merge(source, results))
+	}
+}
+
+// rate is the send rate of the slowest started output.
+func (f *fanout) rate() int64 {
+	var min int64 = -1
+	for _, w := range f.workers {
+		if r := w.sent.Rate(); w.started && (min < 0 || r < min) {
+			min = r
+		}
+	}
+	if min < 0 {
+		return 0
+	}
+	return min
+}
+
+// status describes each output, with the health of ones that have it.
+func (f *fanout) status() []OutputStatus {
+	status := make([]OutputStatus, len(f.workers))
+	for i, w := range f.workers {
+		status[i] = OutputStatus{
+			Name:   w.Name,
+			Group:  w.Group,
+			Colors: make(map[int]string),
+		}
+		if w.started {
+			status[i].FPS = w.sent.Rate()
+		}
+		if h, ok := sink.HealthOf(w.Sink); ok {
+			status[i].Health = &h
+		}
+		w.mu.Lock()
+		for id, c := range w.last {
+			status[i].Colors[id] = c.Clamped().Hex()
+		}
+		w.mu.Unlock()
+	}
+	return status
+}
+
+// Stop stops every started sink.
+func (f *fanout) Stop() {
+	for _, w := range f.workers {
+		if !w.started {
+			continue
+		}
+		close(w.frames)
+		<-w.done
+		if err := w.Sink.Stop(); err != nil {
+			w.log.WithError(err).Error("unable to stop output")
+		}
+		w.started = false
+	}
+}
+
+// merge stores the colors from source and returns the colors from every
+// source, lights sampled from more than one are averaged.
+func (w *worker) merge(source string, colors map[int]colorful.Color) map[int]colorful.Color {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.latest[source] = colors
+	if len(w.latest) == 1 {
+		return colors
+	}
+
+	all := make(map[int][]colorful.Color)
+	for _, c := range w.latest {
+		for id, clr := range c {
+			all[id] = append(all[id], clr)
+		}
+	}
+	merged := make(map[int]colorful.Color, len(all))
+	for id, c := range all {
+		merged[id] = extract.Mean(c...)
+	}
+	return merged
+}
+
+// run sends colors as they come until frames is closed.
+func (w *worker) run() {
+	defer close(w.done)
+
+	for colors := range w.frames {
+		w.send(colors)
+	}
+}
+
+// pace sends colors at the output's rate until frames is closed,
+// skipping or interpolating colors that come faster or slower.
+func (w *worker) pace() {
+	defer close(w.done)
+
+	p := &pacer{interval: time.Duration(float64(time.Second) / w.Rate)}
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case colors, ok := <-w.frames:
+			if !ok {
+				return
+			}
+			p.push(colors, time.Now())
+		case now := <-ticker.C:
+			if colors := p.colors(now); colors != nil {
+				w.send(colors)
+			}
+		}
+	}
+}
+
+// dropOldestColors sends colors on ch, which holds a single set,
+// replacing the set there if the worker hasn't taken it yet.  It never
+// blocks.
+func dropOldestColors(ch chan map[int]colorful.Color, colors map[int]colorful.Color) {
+	select {
+	case ch <- colors:
+		return
+	default:
+	}
+
+	select {
+	case <-ch:
+	default:
+	}
+	select {
+	case ch <- colors:
+	default:
+	}
+}
+
+// send sets colors on the sink.  Errors are only logged when they
+// change so a sink that is down doesn't flood the log.
+func (w *worker) send(colors map[int]colorful.Color) {
+	err := w.Sink.Set(colors)
+	switch {
+	case err != nil && err.Error() != w.lastErr:
+		w.log.WithError(err).Error("unable to set colors")
+		w.errs.set(err)
+		w.lastErr = err.Error()
+	case err == nil && w.lastErr != "":
+		w.log.Info("output recovered")
+		w.lastErr = ""
+	}
+	if err == nil {
+		w.sent.Incr(1)
+		w.mu.Lock()
+		w.last = colors
+		w.mu.Unlock()
+	}
+}
+
+// pacer decides the colors to send on each tick of an output's rate.
+// Colors that come faster than the rate are skipped to the latest, ones
+// that come slower fade from the previous over the time between them,
+// which puts the lights a frame behind.
+type pacer struct {
+	interval time.Duration // time between ticks
+
+	from, to map[int]colorful.Color
+	at       time.Time     // when to came
+	span     time.Duration // time between the last two colors
+}
+
+// maxSpan is the longest gap faded over, longer ones are a source that
+// stalled rather than its frame rate.
+const maxSpan = time.Second
+
+func (p *pacer) push(colors map[int]colorful.Color, now time.Time) {
+	if p.to != nil {
+		p.from = p.colors(now)
+		p.span = now.Sub(p.at)
+	}
+	p.to, p.at = colors, now
+}
+
+// colors returns the colors to send at now, nil before any came.
+func (p *pacer) colors(now time.Time) map[int]colorful.Color {
+	if p.from == nil || p.span <= p.interval || p.span > maxSpan {
+		return p.to
+	}
+	t := float64(now.Sub(p.at)) / float64(p.span)
+	if t >= 1 {
+		return p.to
+	}
+
+	colors := make(map[int]colorful.Color, len(p.to))
+	for id, to := range p.to {
+		from, ok := p.from[id]
+		if !ok {
+			colors[id] = to
+			continue
+		}
+		colors[id] = from.BlendLab(to, t).Clamped()
+	}
+	return colors
+}
@@ -0,0 +1,203 @@
+package chromatic
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Khabi/chromatic/internal/location"
+	"github.com/Khabi/chromatic/internal/sink"
+	"github.com/lucasb-eyer/go-colorful"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeSink struct {
+	startErr error
+	block    chan struct{} // when set, Set waits for it to close
+
+	mu   sync.Mutex
+	sets []map[int]colorful.Color
+}
+
+func (f *fakeSink) Start() error { return f.startErr }
+func (f *fakeSink) Stop() error  { return nil }
+
+func (f *fakeSink) Set(colors map[int]colorful.Color) error {
+	if f.block != nil {
+		<-f.block
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sets = append(f.sets, colors)
+	return nil
+}
+
+func (f *fakeSink) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.sets)
+}
+
+// last returns the colors last set, nil before any were.
+func (f *fakeSink) last() map[int]colorful.Color {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.sets) == 0 {
+		return nil
+	}
+	return f.sets[len(f.sets)-1]
+}
+
+func TestFanout(t *testing.T) {
+	frame := func(red uint8) image.Image {
+		img := image.NewRGBA(image.Rect(0, 0, 16, 9))
+		draw.Draw(img, img.Bounds(), image.NewUniform(color.RGBA{red, 0, 0, 255}), image.Point{}, draw.Src)
+		return img
+	}
+	whole := map[string]location.Bounds{"tv": {{ID: 1, X: 0, Y: 0, Width: 100, Height: 100}}}
+
+	fast := &fakeSink{}
+	slow := &fakeSink{block: make(chan struct{})}
+	broken := &fakeSink{startErr: errors.New("bridge is offline")}
+
+	f := newFanout([]Output{
+		{Name: "fast", Sink: fast, Bounds: whole},
+		{Name: "slow", Sink: slow, Bounds: map[string]location.Bounds{"tv": {{ID: 7, X: 0, Y: 0, Width: 100, Height: 100}}}},
+		{Name: "broken", Sink: broken, Bounds: whole},
+	}, &lastError{})
+	assert.NoError(t, f.Start())
+
+	// A slow sink doesn't hold up the others, it only gets the latest
+	// colors once it is free.
+	for i := 1; i <= 10; i++ {
+		f.Set("tv", frame(uint8(25*i)), Average)
+	}
+	assert.Eventually(t, func() bool {
+		last := fast.last()
+		return last != nil && last[1] == colorful.Color{R: 250.0 / 255}
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, 0, slow.count())
+
+	close(slow.block)
+	f.Stop()
+	assert.LessOrEqual(t, slow.count(), 2)
+	assert.Equal(t, colorful.Color{R: 250.0 / 255}, slow.last()[7])
+	assert.Equal(t, 0, broken.count())
+
+	// Every output failing to start is an error.
+	assert.EqualError(t, newFanout([]Output{{Sink: broken}}, &lastError{}).Start(), "no outputs could be started")
+}
+
+func TestFanoutSources(t *testing.T) {
+	frame := func(c color.Color) image.Image {
+		img := image.NewRGBA(image.Rect(0, 0, 16, 9))
+		draw.Draw(img, img.Bounds(), image.NewUniform(c), image.Point{}, draw.Src)
+		return img
+	}
+	whole := func(ids ...int) location.Bounds {
+		var b location.Bounds
+		for _, id := range ids {
+			b = append(b, location.Bound{ID: id, X: 0, Y: 0, Width: 100, Height: 100})
+		}
+		return b
+	}
+
+	out := &fakeSink{}
+	f := newFanout([]Output{{Sink: out, Bounds: map[string]location.Bounds{
+		"tv":      whole(1, 2),
+		"monitor": whole(2, 3),
+	}}}, &lastError{})
+	assert.NoError(t, f.Start())
+
+	f.Set("tv", frame(color.RGBA{255, 0, 0, 255}), Average)
+	time.Sleep(20 * time.Millisecond)
+	f.Set("monitor", frame(color.RGBA{0, 0, 255, 255}), Average)
+	f.Set("hdmi", frame(color.RGBA{0, 255, 0, 255}), Average)
+	f.Stop()
+
+	assert.Equal(t, 2, out.count())
+	last := out.sets[1]
+	assert.Len(t, last, 3)
+	assert.InDelta(t, 1, last[1].R, 0.001)
+	assert.InDelta(t, 1, last[3].B, 0.001)
+
+	// Lights sampled from both sources are averaged.
+	assert.InDelta(t, 0.5, last[2].R, 0.001)
+	assert.InDelta(t, 0.5, last[2].B, 0.001)
+}
+
+func TestPacer(t *testing.T) {
+	red, blue := colorful.Color{R: 1}, colorful.Color{B: 1}
+	start := time.Now()
+	p := &pacer{interval: 40 * time.Millisecond}
+	assert.Nil(t, p.colors(start))
+
+	// Colors slower than the rate fade over the time between them.
+	p.push(map[int]colorful.Color{1: red}, start)
+	assert.Equal(t, map[int]colorful.Color{1: red}, p.colors(start.Add(40*time.Millisecond)))
+	p.push(map[int]colorful.Color{1: blue, 2: red}, start.Add(200*time.Millisecond))
+	half := p.colors(start.Add(300 * time.Millisecond))
+	assert.Equal(t, red.BlendLab(blue, 0.5).Clamped(), half[1])
+	assert.Equal(t, red, half[2])
+	assert.Equal(t, map[int]colorful.Color{1: blue, 2: red}, p.colors(start.Add(400*time.Millisecond)))
+
+	// Faster ones skip to the latest.
+	p.push(map[int]colorful.Color{1: blue}, start.Add(410*time.Millisecond))
+	p.push(map[int]colorful.Color{1: red}, start.Add(420*time.Millisecond))
+	assert.Equal(t, map[int]colorful.Color{1: red}, p.colors(start.Add(425*time.Millisecond)))
+
+	// So do ones after a stall.
+	p.push(map[int]colorful.Color{1: blue}, start.Add(5*time.Second))
+	assert.Equal(t, map[int]colorful.Color{1: blue}, p.colors(start.Add(5*time.Second)))
+}
+
+func TestFanoutRate(t *testing.T) {
+	frame := image.NewRGBA(image.Rect(0, 0, 16, 9))
+	out := &fakeSink{}
+	f := newFanout([]Output{{Sink: out, Rate: 50, Bounds: map[string]location.Bounds{
+		"tv": {{ID: 1, X: 0, Y: 0, Width: 100, Height: 100}},
+	}}}, &lastError{})
+	assert.NoError(t, f.Start())
+
+	// A single frame keeps being sent at the output's rate.
+	f.Set("tv", frame, Average)
+	time.Sleep(200 * time.Millisecond)
+	f.Stop()
+	assert.InDelta(t, 10, out.count(), 3)
+}
+
+// healthySink is a fakeSink that reports its health.
+type healthySink struct {
+	fakeSink
+}
+
+func (h *healthySink) Health() sink.Health {
+	return sink.Health{Connected: true, Reconnects: 1}
+}
+
+func TestFanoutStatus(t *testing.T) {
+	frame := image.NewRGBA(image.Rect(0, 0, 16, 9))
+	draw.Draw(frame, frame.Bounds(), image.NewUniform(color.RGBA{255, 0, 0, 255}), image.Point{}, draw.Src)
+	whole := map[string]location.Bounds{"tv": {{ID: 1, X: 0, Y: 0, Width: 100, Height: 100}}}
+
+	hue := &healthySink{}
+	f := newFanout([]Output{
+		{Name: "hue", Group: "TV area", Sink: hue, Bounds: whole},
+		{Name: "strip", Sink: &fakeSink{}},
+	}, &lastError{})
+	assert.NoError(t, f.Start())
+	f.Set("tv", frame, Average)
+	assert.Eventually(t, func() bool { return hue.count() == 1 }, time.Second, time.Millisecond)
+	f.Stop()
+
+	status := f.status()
+	assert.Equal(t, "TV area", status[0].Group)
+	assert.Equal(t, &sink.Health{Connected: true, Reconnects: 1}, status[0].Health)
+	assert.Equal(t, map[int]string{1: "#ff0000"}, status[0].Colors)
+	assert.Nil(t, status[1].Health)
+	assert.Empty(t, status[1].Colors)
+}
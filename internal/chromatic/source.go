@@ -0,0 +1,356 @@
+package chromatic
+
+import (
+	"errors"
+	"image"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Khabi/chromatic/internal/decode"
+	"github.com/korandiz/v4l"
+	"github.com/paulbellamy/ratecounter"
+	"github.com/sirupsen/logrus"
+)
+
+// Device captures raw frames.
+type Device interface {
+	TurnOn() error
+	Capture() ([]byte, error)
+	TurnOff()
+	Close()
+}
+
+// V4L captures from a video4linux device.
+func V4L(d *v4l.Device) Device {
+	return v4lDevice{d}
+}
+
+type v4lDevice struct {
+	*v4l.Device
+}
+
+// Capture copies the next frame out of the device's buffer, which is
+// reused once the next frame is captured.
+func (d v4lDevice) Capture() ([]byte, error) {
+	buf, err := d.Device.Capture()
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, buf.Size())
+	buf.Read(b)
+	return b, nil
+}
+
+// Source is a capture device, each one is captured from its own
+// goroutine.
+type Source struct {
+	Name    string
+	Device  string // what the device was configured as, for status
+	Profile string
+	Video   Device
+	Decode  decode.Func // decode.Full when nil
+
+	// Open opens the device again with the same profile, after it was
+	// unplugged.  Sources without it stop when capturing fails.
+	Open func() (Device, decode.Func, error)
+}
+
+// reopenInterval is how often an unplugged source is looked for.
+var reopenInterval = time.Second
+
+// modeSwitch holds the mode shared by every capture.
+type modeSwitch struct {
+	mu   sync.Mutex
+	mode Mode
+}
+
+func newModeSwitch(m Mode) *modeSwitch {
+	return &modeSwitch{mode: m}
+}
+
+func (s *modeSwitch) get() Mode {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.mode
+}
+
+func (s *modeSwitch) set(m Mode) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mode = m
+}
+
+// capture runs the pipeline for a source until it is stopped.  Raw
+// frames are captured, decoded and sampled by separate goroutines joined
+// by channels that only hold the latest frame, so a slow stage drops old
+// frames rather than holding up the ones before it.
+type capture struct {
+	Source
+	fps      *ratecounter.RateCounter // frames sampled
+	captured *ratecounter.RateCounter // frames from the device, before the governor drops any
+	gov      *governor
+	next     time.Time // when the governor lets the next frame through
+	errs     *lastError
+	log      *logrus.Entry
+	quit     chan struct{}
+	done     chan struct{}
+
+	unavailable int32 // set while waiting for the device to return
+	delay       int64 // moving average of the latency in nanoseconds
+}
+
+// rawFrame is a captured frame and the decoder for it, which changes if
+// the device is reopened.
+type rawFrame struct {
+	b      []byte
+	decode decode.Func
+	at     time.Time // when it was captured
+}
+
+// frame is a decoded rawFrame.
+type frame struct {
+	img image.Image
+	at  time.Time
+}
+
+// startCapture turns on the source and starts its pipeline.  A source
+// that can be reopened starts even when it is unplugged.
+func startCapture(src Source, out *fanout, mode *modeSwitch, gov *governor, errs *lastError) (*capture, error) {
+	c := &capture{
+		Source:   src,
+		fps:      ratecounter.NewRateCounter(1 * time.Second),
+		captured: ratecounter.NewRateCounter(1 * time.Second),
+		gov:      gov,
+		errs:     errs,
+		log:      logrus.WithField("source", src.Name),
+		quit:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if c.Decode == nil {
+		c.Decode = decode.Full
+	}
+
+	if c.Video != nil {
+		if err := c.Video.TurnOn(); err != nil {
+			if c.Open == nil {
+				return nil, err
+			}
+			c.close()
+		}
+	}
+	if c.Video == nil {
+		if c.Open == nil {
+			return nil, errors.New("source has no device")
+		}
+		c.log.Warn("source unavailable, waiting for it to return")
+		c.errs.set(errors.New("source unavailable"))
+		atomic.StoreInt32(&c.unavailable, 1)
+	}
+
+	raw := make(chan rawFrame, 1)
+	frames := make(chan frame, 1)
+	go c.capture(raw)
+	go c.decode(raw, frames)
+	go c.extract(frames, out, mode)
+	return c, nil
+}
+
+// capture reads raw frames from the device until quit is closed.  When
+// the device goes away it waits for it to come back.
+func (c *capture) capture(raw chan rawFrame) {
+	defer close(raw)
+
+	for {
+		select {
+		case <-c.quit:
+			return
+		default:
+		}
+
+		if c.Video == nil && !c.reopen() {
+			return
+		}
+
+		b, err := c.Video.Capture()
+		if err != nil {
+			c.errs.set(err)
+			if c.Open == nil {
+				c.log.WithError(err).Error("unable to capture, stopping source")
+				return
+			}
+			c.log.WithError(err).Warn("source unavailable, waiting for it to return")
+			atomic.StoreInt32(&c.unavailable, 1)
+			c.Video.TurnOff()
+			c.close()
+			continue
+		}
+		now := time.Now()
+		c.captured.Incr(1)
+		if !c.gov.due(&c.next, now) {
+			continue
+		}
+		dropOldestRaw(raw, rawFrame{b, c.Decode, now})
+	}
+}
+
+// reopen opens the device again once it is back, it gives up when quit
+// is closed.
+func (c *capture) reopen() bool {
+	ticker := time.NewTicker(reopenInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.quit:
+			return false
+		case <-ticker.C:
+		}
+
+		dev, dec, err := c.Open()
+		if err != nil {
+			c.log.WithError(err).Debug("source is still unavailable")
+			continue
+		}
+		if err := dev.TurnOn(); err != nil {
+			c.log.WithError(err).Debug("source is still unavailable")
+			dev.Close()
+			continue
+		}
+
+		c.Video, c.Decode = dev, dec
+		if c.Decode == nil {
+			c.Decode = decode.Full
+		}
+		atomic.StoreInt32(&c.unavailable, 0)
+		c.log.Info("source reopened")
+		return true
+	}
+}
+
+// close closes a device that can't capture any more.
+func (c *capture) close() {
+	c.Video.Close()
+	c.Video = nil
+}
+
+// available reports whether the source is capturing.
+func (c *capture) available() bool {
+	return atomic.LoadInt32(&c.unavailable) == 0
+}
+
+// decode turns raw frames into images.
+func (c *capture) decode(raw <-chan rawFrame, frames chan frame) {
+	defer close(frames)
+
+	for raw := range raw {
+		img, err := raw.decode(raw.b)
+		if err != nil {
+			c.log.WithError(err).Error("unable to decode frame")
+			c.errs.set(err)
+			continue
+		}
+		dropOldestFrame(frames, frame{img, raw.at})
+	}
+}
+
+// extract samples each image for the outputs.
+func (c *capture) extract(frames <-chan frame, out *fanout, mode *modeSwitch) {
+	defer close(c.done)
+
+	for f := range frames {
+		out.Set(c.Name, f.img, mode.get())
+		c.fps.Incr(1)
+		c.measure(time.Since(f.at))
+	}
+}
+
+// measure adds the latency of a frame to the moving average.
+func (c *capture) measure(d time.Duration) {
+	avg := atomic.LoadInt64(&c.delay)
+	if avg == 0 {
+		avg = int64(d)
+	} else {
+		avg += (int64(d) - avg) / 8
+	}
+	atomic.StoreInt64(&c.delay, avg)
+}
+
+// latency is how long frames take from capture until their colors are
+// handed to the outputs, on average.
+func (c *capture) latency() time.Duration {
+	return time.Duration(atomic.LoadInt64(&c.delay))
+}
+
+// stop waits for the pipeline to drain and turns off the source.  It
+// returns the source with the device it ended up with, which is nil if
+// it is unplugged.
+func (c *capture) stop() Source {
+	close(c.quit)
+	<-c.done
+	if c.Video != nil {
+		c.Video.TurnOff()
+	}
+	return c.Source
+}
+
+// dropOldestRaw sends f on ch, which holds a single frame, replacing the
+// frame there if decode hasn't taken it yet.  It never blocks.
+func dropOldestRaw(ch chan rawFrame, f rawFrame) {
+	select {
+	case ch <- f:
+		return
+	default:
+	}
+
+	select {
+	case <-ch:
+	default:
+	}
+	select {
+	case ch <- f:
+	default:
+	}
+}
+
+// dropOldestFrame is dropOldestRaw for decoded frames.
+func dropOldestFrame(ch chan frame, f frame) {
+	select {
+	case ch <- f:
+		return
+	default:
+	}
+
+	select {
+	case <-ch:
+	default:
+	}
+	select {
+	case ch <- f:
+	default:
+	}
+}
+
+// rate is the frame rate of the slowest capture, every light is
+// updated at least this often.
+func rate(captures []*capture) int64 {
+	var min int64
+	for i, c := range captures {
+		if r := c.fps.Rate(); i == 0 || r < min {
+			min = r
+		}
+	}
+	return min
+}
+
+// captureRate is the frame rate of the fastest device, the most there
+// is to sample.
+func captureRate(captures []*capture) float64 {
+	var max int64
+	for _, c := range captures {
+		if r := c.captured.Rate(); r > max {
+			max = r
+		}
+	}
+	return float64(max)
+}
@@ -0,0 +1,175 @@
+package chromatic
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Khabi/chromatic/internal/decode"
+	"github.com/Khabi/chromatic/internal/location"
+	"github.com/paulbellamy/ratecounter"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDropOldest(t *testing.T) {
+	ch := make(chan frame, 1)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		dropOldestFrame(ch, frame{at: start.Add(time.Duration(i))})
+	}
+	assert.Equal(t, start.Add(2), (<-ch).at)
+	assert.Len(t, ch, 0)
+}
+
+func TestPipeline(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 16, 9))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.RGBA{0, 0, 255, 255}), image.Point{}, draw.Src)
+	var buf bytes.Buffer
+	assert.NoError(t, jpeg.Encode(&buf, img, nil))
+
+	out := &fakeSink{}
+	f := newFanout([]Output{{Sink: out, Bounds: map[string]location.Bounds{
+		"tv": {{ID: 1, X: 0, Y: 0, Width: 100, Height: 100}},
+	}}}, &lastError{})
+	assert.NoError(t, f.Start())
+	defer f.Stop()
+
+	c := &capture{
+		Source: Source{Name: "tv"},
+		fps:    ratecounter.NewRateCounter(time.Second),
+		errs:   &lastError{},
+		log:    logrus.WithField("source", "tv"),
+		done:   make(chan struct{}),
+	}
+	raw := make(chan rawFrame, 1)
+	frames := make(chan frame, 1)
+	go c.decode(raw, frames)
+	go c.extract(frames, f, newModeSwitch(Average))
+
+	// Frames that fail to decode are skipped.
+	raw <- rawFrame{[]byte("not a jpeg"), decode.Full, time.Now()}
+	raw <- rawFrame{buf.Bytes(), decode.Full, time.Now()}
+	close(raw)
+
+	select {
+	case <-c.done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("pipeline did not drain")
+	}
+	assert.Equal(t, int64(1), c.fps.Rate())
+	assert.Equal(t, "image: unknown format", c.errs.get().Message)
+	assert.Greater(t, int64(c.latency()), int64(0))
+
+	f.Stop()
+	assert.Equal(t, 1, out.count())
+	assert.InDelta(t, 1, out.sets[0][1].B, 0.02)
+}
+
+// fakeDevice captures the same frame until it is unplugged.
+type fakeDevice struct {
+	frame []byte
+
+	mu     sync.Mutex
+	left   int // frames until it is unplugged, -1 for never
+	on     bool
+	closed bool
+}
+
+func (d *fakeDevice) TurnOn() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.on = true
+	return nil
+}
+
+func (d *fakeDevice) Capture() ([]byte, error) {
+	time.Sleep(time.Millisecond)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.left == 0 {
+		return nil, errors.New("no such device")
+	}
+	if d.left > 0 {
+		d.left--
+	}
+	return d.frame, nil
+}
+
+func (d *fakeDevice) TurnOff() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.on = false
+}
+
+func (d *fakeDevice) Close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.closed = true
+}
+
+func (d *fakeDevice) state() (on, closed bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.on, d.closed
+}
+
+func TestReopen(t *testing.T) {
+	defer func(d time.Duration) { reopenInterval = d }(reopenInterval)
+	reopenInterval = 10 * time.Millisecond
+
+	var buf bytes.Buffer
+	assert.NoError(t, jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 16, 9)), nil))
+
+	out := &fakeSink{}
+	f := newFanout([]Output{{Sink: out, Bounds: map[string]location.Bounds{
+		"tv": {{ID: 1, X: 0, Y: 0, Width: 100, Height: 100}},
+	}}}, &lastError{})
+	assert.NoError(t, f.Start())
+	defer f.Stop()
+
+	first := &fakeDevice{frame: buf.Bytes(), left: 3}
+	second := &fakeDevice{frame: buf.Bytes(), left: -1}
+	var plugged int32
+	c, err := startCapture(Source{
+		Name:  "tv",
+		Video: first,
+		Open: func() (Device, decode.Func, error) {
+			if atomic.LoadInt32(&plugged) == 0 {
+				return nil, nil, errors.New("no such file or directory")
+			}
+			return second, decode.Full, nil
+		},
+	}, f, newModeSwitch(Average), newGovernor(Governor{}), &lastError{})
+	assert.NoError(t, err)
+
+	// The first device is unplugged after a few frames and the source
+	// waits for it to return.
+	assert.Eventually(t, func() bool { return !c.available() }, time.Second, time.Millisecond)
+	assert.False(t, sourceStatus([]Source{{Name: "tv"}}, []*capture{c})[0].Available)
+	on, closed := first.state()
+	assert.False(t, on)
+	assert.True(t, closed)
+
+	sent := out.count()
+	atomic.StoreInt32(&plugged, 1)
+	assert.Eventually(t, c.available, time.Second, time.Millisecond)
+	assert.Eventually(t, func() bool { return out.count() > sent }, time.Second, time.Millisecond)
+
+	src := c.stop()
+	assert.Equal(t, second, src.Video)
+	on, closed = second.state()
+	assert.False(t, on)
+	assert.False(t, closed)
+
+	// Without a way to reopen it, an unplugged source can't start.
+	_, err = startCapture(Source{Name: "tv"}, f, newModeSwitch(Average), newGovernor(Governor{}), &lastError{})
+	assert.EqualError(t, err, "source has no device")
+}
@@ -0,0 +1,88 @@
+package chromatic
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Khabi/chromatic/internal/sink"
+)
+
+// ServerStatus is what Run reports when asked for its Status.
+type ServerStatus struct {
+	State        string         `json:"state"`
+	Mode         string         `json:"mode"`
+	Uptime       float64        `json:"uptime"`        // seconds since Run started
+	FPS          int64          `json:"fps"`           // frames sampled a second by the slowest source
+	CaptureLimit float64        `json:"capture_limit"` // frames a second sources are limited to, 0 when they aren't
+	OutputFPS    int64          `json:"output_fps"`    // colors sent a second by the slowest output
+	LastError    *ErrorStatus   `json:"last_error,omitempty"`
+	Sources      []SourceStatus `json:"sources"`
+	Outputs      []OutputStatus `json:"outputs"`
+}
+
+// SourceStatus describes a source and how fast it is captured.
+type SourceStatus struct {
+	Name      string  `json:"name"`
+	Device    string  `json:"device"`
+	Profile   string  `json:"profile,omitempty"`
+	Available bool    `json:"available"`
+	FPS       int64   `json:"fps"`          // frames sampled a second
+	Captured  int64   `json:"captured_fps"` // frames a second from the device
+	Latency   float64 `json:"latency_ms"`   // from capture to the colors reaching the outputs
+}
+
+// OutputStatus describes an output and the colors it last sent.
+type OutputStatus struct {
+	Name   string         `json:"name"`
+	Group  string         `json:"group,omitempty"` // hue entertainment group or configuration
+	FPS    int64          `json:"fps"`             // colors sent a second
+	Health *sink.Health   `json:"health,omitempty"`
+	Colors map[int]string `json:"colors"` // hex color of each light
+}
+
+// ErrorStatus is the last error logged by a source or output.
+type ErrorStatus struct {
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// lastError keeps the most recent error from any source or output.
+type lastError struct {
+	mu     sync.Mutex
+	status *ErrorStatus
+}
+
+func (l *lastError) set(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.status = &ErrorStatus{Message: err.Error(), Time: time.Now()}
+}
+
+func (l *lastError) get() *ErrorStatus {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.status
+}
+
+// sourceStatus describes each source, with the rates of its capture
+// while running.
+func sourceStatus(sources []Source, captures []*capture) []SourceStatus {
+	status := make([]SourceStatus, len(sources))
+	for i, src := range sources {
+		status[i] = SourceStatus{
+			Name:      src.Name,
+			Device:    src.Device,
+			Profile:   src.Profile,
+			Available: src.Video != nil,
+		}
+		if i >= len(captures) {
+			continue
+		}
+		c := captures[i]
+		status[i].Available = c.available()
+		status[i].FPS = c.fps.Rate()
+		status[i].Captured = c.captured.Rate()
+		status[i].Latency = float64(c.latency()) / float64(time.Millisecond)
+	}
+	return status
+}
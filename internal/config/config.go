@@ -0,0 +1,917 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Khabi/chromatic/internal/api"
+	"github.com/Khabi/chromatic/internal/chromatic"
+	"github.com/Khabi/chromatic/internal/decode"
+	"github.com/Khabi/chromatic/internal/hue"
+	"github.com/Khabi/chromatic/internal/location"
+	"github.com/Khabi/chromatic/internal/mqtt"
+	"github.com/Khabi/chromatic/internal/sink"
+	"github.com/mitchellh/mapstructure"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// Config is the typed form of chromatic.yaml.
+type Config struct {
+	LogLevel string   `mapstructure:"log_level"`
+	Bind     string   `mapstructure:"bind"`
+	Socket   Socket   `mapstructure:"socket"`
+	Tokens   []Token  `mapstructure:"tokens"` // when set, requests to bind need one
+	TLS      TLS      `mapstructure:"tls"`
+	Allow    []string `mapstructure:"allow"` // addresses or cidrs allowed to use bind, any when empty
+	Video    Video    `mapstructure:"video"`
+	Sources  []Video  `mapstructure:"sources"` // used instead of video to capture from several devices
+	Light    Light    `mapstructure:"light"`
+	Outputs  []Light  `mapstructure:"outputs"` // used instead of light to drive several at once
+	MQTT     MQTT     `mapstructure:"mqtt"`
+	Rate     Rate     `mapstructure:"rate"`
+}
+
+// Videos returns every configured capture device, either the single
+// video or each of sources.  The first one is sampled by regions that
+// don't name a source.
+func (c *Config) Videos() []Video {
+	if len(c.Sources) > 0 {
+		return c.Sources
+	}
+	return []Video{c.Video}
+}
+
+// Lights returns every configured output, either the single light or
+// each of outputs.
+func (c *Config) Lights() []Light {
+	if len(c.Outputs) > 0 {
+		return c.Outputs
+	}
+	return []Light{c.Light}
+}
+
+// Socket is a unix socket the api also listens on, so local tools can
+// control chromatic without a tcp port.
+type Socket struct {
+	Path  string `mapstructure:"path"`  // like /run/chromatic.sock
+	Mode  uint32 `mapstructure:"mode"`  // permissions like 0660, the default
+	Group string `mapstructure:"group"` // group allowed to use it with mode
+}
+
+// FileMode returns the socket's permissions.  YAML reads a leading 0 as
+// octal, so the mode is written like it is for chmod.
+func (s Socket) FileMode() (os.FileMode, error) {
+	if s.Mode == 0 {
+		return 0660, nil
+	}
+	if s.Mode > 0777 {
+		return 0, fmt.Errorf("invalid mode %d, expected permissions like 0660", s.Mode)
+	}
+	return os.FileMode(s.Mode), nil
+}
+
+// Token lets a client use the api, scope is read for only the status or
+// control for everything.
+type Token struct {
+	Token string `mapstructure:"token"`
+	Scope string `mapstructure:"scope"` // defaults to read
+}
+
+// TLS serves bind over https with a certificate, or one generated when
+// self_signed is set.  Generated ones are kept in cert and key if set.
+type TLS struct {
+	Cert       string `mapstructure:"cert"`
+	Key        string `mapstructure:"key"`
+	SelfSigned bool   `mapstructure:"self_signed"`
+}
+
+// Enabled reports whether bind is served over tls.
+func (t TLS) Enabled() bool {
+	return t.Cert != "" || t.SelfSigned
+}
+
+// API converts the config for the api.
+func (c *Config) API() api.Options {
+	mode, _ := c.Socket.FileMode() // Already checked by validation.
+	opts := api.Options{
+		Bind:        c.Bind,
+		Socket:      c.Socket.Path,
+		SocketMode:  mode,
+		SocketGroup: c.Socket.Group,
+		Cert:        c.TLS.Cert,
+		Key:         c.TLS.Key,
+		SelfSigned:  c.TLS.SelfSigned,
+	}
+	for _, t := range c.Tokens {
+		opts.Tokens = append(opts.Tokens, api.Token{Value: t.Token, Scope: t.scope()})
+	}
+	for _, a := range c.Allow {
+		n, _ := parseCIDR(a)
+		opts.Allow = append(opts.Allow, n)
+	}
+	return opts
+}
+
+func (t Token) scope() string {
+	if t.Scope == "" {
+		return api.ScopeRead
+	}
+	return t.Scope
+}
+
+// parseCIDR parses a cidr, or a single address.
+func parseCIDR(s string) (*net.IPNet, error) {
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid address %q, expected an ip or cidr like 192.168.1.0/24", s)
+		}
+		bits := 8 * net.IPv6len
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 8*net.IPv4len
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address %q, expected an ip or cidr like 192.168.1.0/24", s)
+	}
+	return n, nil
+}
+
+// validateAPI checks who can use the api and how.
+func (c *Config) validateAPI() Errors {
+	var errs Errors
+	seen := make(map[string]bool)
+	for i, t := range c.Tokens {
+		switch {
+		case t.Token == "":
+			errs = append(errs, fmt.Errorf("tokens.%d.token: is required", i))
+		case seen[t.Token]:
+			errs = append(errs, fmt.Errorf("tokens.%d.token: is already used", i))
+		}
+		seen[t.Token] = true
+		if s := t.scope(); s != api.ScopeRead && s != api.ScopeControl {
+			errs = append(errs, fmt.Errorf("tokens.%d.scope: unknown scope %q, expected read or control", i, s))
+		}
+	}
+
+	switch {
+	case c.TLS.SelfSigned && (c.TLS.Cert == "") != (c.TLS.Key == ""):
+		errs = append(errs, fmt.Errorf("tls.cert and tls.key: both or neither are needed to keep a self signed certificate"))
+	case !c.TLS.SelfSigned && (c.TLS.Cert == "") != (c.TLS.Key == ""):
+		errs = append(errs, fmt.Errorf("tls.cert and tls.key: both are required"))
+	}
+	if (len(c.Tokens) > 0 || c.TLS.Enabled() || len(c.Allow) > 0) && c.Bind == "" {
+		errs = append(errs, fmt.Errorf("bind: is required for tokens, tls and allow"))
+	}
+
+	for i, a := range c.Allow {
+		if _, err := parseCIDR(a); err != nil {
+			errs = append(errs, fmt.Errorf("allow.%d: %w", i, err))
+		}
+	}
+	return errs
+}
+
+// OutputRate is how many times a second colors are sent to a light, 0
+// sends them as each frame is sampled.  Hue streams default to
+// hue.StreamRate, faster updates don't show.
+func (c *Config) OutputRate(l Light) float64 {
+	switch {
+	case l.FPS != 0:
+		return l.FPS
+	case c.Rate.Output != 0:
+		return c.Rate.Output
+	case l.Type == "" || l.Type == "hue" || l.Type == "hue_v2":
+		return hue.StreamRate
+	}
+	return 0
+}
+
+// Rate limits how fast frames are sampled and colors sent.
+type Rate struct {
+	Capture  float64 `mapstructure:"capture"`  // frames sampled a second from each source, 0 samples every frame
+	Output   float64 `mapstructure:"output"`   // colors sent a second to each light, lights can set their own fps
+	Adaptive bool    `mapstructure:"adaptive"` // lower the capture rate while the cpu is busy
+	MaxCPU   float64 `mapstructure:"max_cpu"`  // cpu usage in % adaptive mode keeps under, defaults to 80
+}
+
+// Governor converts the config for the capture loop.
+func (r Rate) Governor() chromatic.Governor {
+	return chromatic.Governor{
+		FPS:      r.Capture,
+		Adaptive: r.Adaptive,
+		MaxCPU:   r.MaxCPU / 100,
+	}
+}
+
+func (r Rate) validate() Errors {
+	var errs Errors
+	if r.Capture < 0 {
+		errs = append(errs, fmt.Errorf("rate.capture: can't be negative"))
+	}
+	if r.Output < 0 {
+		errs = append(errs, fmt.Errorf("rate.output: can't be negative"))
+	}
+	if r.MaxCPU < 0 || r.MaxCPU > 100 {
+		errs = append(errs, fmt.Errorf("rate.max_cpu: %v is outside of 0 to 100%%", r.MaxCPU))
+	}
+	return errs
+}
+
+// MQTT configures the optional mqtt integration, it is enabled by
+// setting a broker.
+type MQTT struct {
+	Broker          string        `mapstructure:"broker"` // like tcp://localhost:1883
+	ClientID        string        `mapstructure:"client_id"`
+	Username        string        `mapstructure:"username"`
+	Password        string        `mapstructure:"password"`
+	Topic           string        `mapstructure:"topic"`
+	Interval        time.Duration `mapstructure:"interval"`
+	Discovery       bool          `mapstructure:"discovery"`
+	DiscoveryPrefix string        `mapstructure:"discovery_prefix"`
+}
+
+// Options converts the config for the mqtt client.
+func (m MQTT) Options() mqtt.Options {
+	return mqtt.Options{
+		Broker:          m.Broker,
+		ClientID:        m.ClientID,
+		Username:        m.Username,
+		Password:        m.Password,
+		Topic:           m.Topic,
+		Interval:        m.Interval,
+		Discovery:       m.Discovery,
+		DiscoveryPrefix: m.DiscoveryPrefix,
+	}
+}
+
+// Video configures the capture device.
+type Video struct {
+	Name    string `mapstructure:"name"`   // what regions call the source, defaults to the device
+	Device  string `mapstructure:"device"` // a path, /dev/v4l/by-id name or card name
+	Profile string `mapstructure:"profile"`
+	Decode  string `mapstructure:"decode"` // full or dc, dc is much cheaper on small boards
+}
+
+// Label is the name regions use for the source.
+func (v Video) Label() string {
+	if v.Name != "" {
+		return v.Name
+	}
+	return v.Device
+}
+
+// validate checks a single capture device, prefix is where it is in
+// the config.
+func (v Video) validate(prefix string) Errors {
+	var errs Errors
+	if v.Device == "" {
+		errs = append(errs, fmt.Errorf("%s.device: is required", prefix))
+	}
+	if v.Profile == "" {
+		errs = append(errs, fmt.Errorf("%s.profile: is required", prefix))
+	} else if p, err := ParseProfile(v.Profile); err != nil {
+		errs = append(errs, fmt.Errorf("%s.profile: %w", prefix, err))
+	} else if v.Decode == decode.ModeDC && p.Format != "" && p.Format != decode.FormatMJPEG {
+		errs = append(errs, fmt.Errorf("%s.decode: dc only works with mjpeg, %s frames aren't compressed", prefix, p.Format))
+	}
+	if _, err := decode.Parse(v.Decode); err != nil {
+		errs = append(errs, fmt.Errorf("%s.decode: %w", prefix, err))
+	}
+	return errs
+}
+
+// Light configures where colors are sent and how lights sample the screen.
+type Light struct {
+	Type string  `mapstructure:"type"` // hue, hue_v2, hue_rest, ddp, e131, wled, adalight or mqtt, defaults to hue
+	Name string  `mapstructure:"name"` // shown in logs, defaults to the type
+	FPS  float64 `mapstructure:"fps"`  // colors sent a second, defaults to rate.output
+
+	// Hue entertainment groups, hue_rest only needs the bridge and username.
+	Bridge    string `mapstructure:"bridge"`
+	Username  string `mapstructure:"username"`
+	ClientKey string `mapstructure:"client_key"`
+	GroupID   int    `mapstructure:"group_id"`
+	GroupName string `mapstructure:"group_name"`
+
+	// Hue v2 entertainment configuration id or name, bindings are keyed
+	// by channel.
+	Configuration string `mapstructure:"configuration"`
+
+	// Hue lights set one at a time through the regular api.
+	Rate       int           `mapstructure:"rate"`       // requests a second, defaults to 10
+	Transition time.Duration `mapstructure:"transition"` // fade between colors, defaults to 100ms
+
+	// Addressable strips driven by ddp, e131, wled or adalight.
+	Address  string        `mapstructure:"address"`  // device address, e131 multicasts when empty
+	Universe int           `mapstructure:"universe"` // first e131 universe
+	Pixels   int           `mapstructure:"pixels"`   // number of pixels to drive
+	Offset   int           `mapstructure:"offset"`   // first pixel on the device
+	Pixel    map[int][]int `mapstructure:"pixel"`    // bound id to the pixels it lights
+	Serial   string        `mapstructure:"serial"`   // adalight serial device
+	Baud     int           `mapstructure:"baud"`     // adalight baud rate, defaults to 115200
+	Order    string        `mapstructure:"order"`    // adalight color order, like rgb or grb
+
+	Binding map[int]Binding   `mapstructure:"binding"` // light id to the regions it samples
+	Regions map[string]Region `mapstructure:"regions"` // named regions bindings can share
+	Strips  []Strip           `mapstructure:"strips"`  // lights with many evenly spaced zones
+}
+
+// Strip splits an edge, or the perimeter, into segments for lights with
+// many zones, see location.Strip.
+type Strip struct {
+	Edge      string  `mapstructure:"edge"`      // top, bottom, left, right or perimeter
+	Count     int     `mapstructure:"count"`     // number of segments
+	Depth     float64 `mapstructure:"depth"`     // how far segments reach into the screen in %
+	Start     string  `mapstructure:"start"`     // corner of the first segment, like top-left corner
+	Direction string  `mapstructure:"direction"` // clockwise or counterclockwise around the perimeter
+	Gap       float64 `mapstructure:"gap"`       // space between segments in % of the edge
+	IDs       []int   `mapstructure:"ids"`       // channel of each segment
+	FirstID   int     `mapstructure:"first_id"`  // first channel when ids isn't set
+	Source    string  `mapstructure:"source"`    // video source to sample, defaults to the first
+}
+
+// Binding is every region a light samples, their colors are averaged.
+// In the config it can be a single region or a list of them.
+type Binding []Region
+
+// Region is a part of the screen to sample.  Exactly one of Name,
+// Width/Height, Polygon or Segment is set.  A plain string in the
+// config is the name of a preset or one of light.regions.
+type Region struct {
+	Name    string       `mapstructure:"region"`
+	X       float64      `mapstructure:"x"`
+	Y       float64      `mapstructure:"y"`
+	Width   float64      `mapstructure:"width"`
+	Height  float64      `mapstructure:"height"`
+	Polygon [][2]float64 `mapstructure:"polygon"`
+	Segment *Segment     `mapstructure:"segment"`
+	Source  string       `mapstructure:"source"` // video source to sample, defaults to the first
+}
+
+// Segment is a line between two points on the grid, Depth is its
+// thickness in % of the screen.
+type Segment struct {
+	From  [2]float64 `mapstructure:"from"`
+	To    [2]float64 `mapstructure:"to"`
+	Depth float64    `mapstructure:"depth"`
+}
+
+// Profile is a parsed video profile.
+type Profile struct {
+	Width  int
+	Height int
+	FPS    int
+	Per    int    // seconds FPS frames take for fractional rates, 0 is 1
+	Format string // pixel format, empty for mjpeg
+}
+
+// Rate is the number of frames a second.
+func (p Profile) Rate() float64 {
+	if p.Per > 1 {
+		return float64(p.FPS) / float64(p.Per)
+	}
+	return float64(p.FPS)
+}
+
+// String is the profile as it is written in the config.
+func (p Profile) String() string {
+	s := fmt.Sprintf("%dx%d@%d", p.Width, p.Height, p.FPS)
+	if p.Per > 1 {
+		s += fmt.Sprintf("/%d", p.Per)
+	}
+	if p.Format != "" && p.Format != decode.FormatMJPEG {
+		s += ":" + p.Format
+	}
+	return s
+}
+
+var profileRe = regexp.MustCompile(`^(\d+)x(\d+)@(\d+)(?:/(\d+))?(?::(\w+))?$`)
+
+// ParseProfile parses a profile in the form WIDTHxHEIGHT@FPS, where FPS
+// can be a fraction like 30000/1001, optionally followed by :FORMAT to
+// capture in something other than mjpeg.
+func ParseProfile(s string) (Profile, error) {
+	m := profileRe.FindStringSubmatch(s)
+	if m == nil {
+		return Profile{}, fmt.Errorf("invalid profile %q, expected WIDTHxHEIGHT@FPS like 1280x720@30", s)
+	}
+
+	// The regex only matches digits, so these can only fail on overflow.
+	var p Profile
+	var err error
+	if p.Width, err = strconv.Atoi(m[1]); err != nil {
+		return Profile{}, fmt.Errorf("invalid profile width %q", m[1])
+	}
+	if p.Height, err = strconv.Atoi(m[2]); err != nil {
+		return Profile{}, fmt.Errorf("invalid profile height %q", m[2])
+	}
+	if p.FPS, err = strconv.Atoi(m[3]); err != nil {
+		return Profile{}, fmt.Errorf("invalid profile fps %q", m[3])
+	}
+	if m[4] != "" {
+		if p.Per, err = strconv.Atoi(m[4]); err != nil {
+			return Profile{}, fmt.Errorf("invalid profile fps %q", m[3]+"/"+m[4])
+		}
+		if p.Per == 0 {
+			return Profile{}, fmt.Errorf("invalid profile %q, fps can't be divided by 0", s)
+		}
+	}
+	if p.Width == 0 || p.Height == 0 || p.FPS == 0 {
+		return Profile{}, fmt.Errorf("invalid profile %q, width, height and fps must be above 0", s)
+	}
+	if p.Format = m[5]; p.Format != "" {
+		if _, err := decode.FourCC(p.Format); err != nil {
+			return Profile{}, err
+		}
+	}
+	return p, nil
+}
+
+// Errors is every problem found while validating a config.
+type Errors []error
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Load decodes and validates the config held by v.
+func Load(v *viper.Viper) (*Config, error) {
+	var c Config
+	hooks := mapstructure.ComposeDecodeHookFunc(
+		regionHook,
+		mapstructure.StringToTimeDurationHookFunc(),
+		mapstructure.StringToSliceHookFunc(","),
+	)
+	if err := v.Unmarshal(&c, viper.DecodeHook(hooks)); err != nil {
+		return nil, err
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// regionHook lets bindings and regions be written in their short forms.
+func regionHook(from reflect.Type, to reflect.Type, data interface{}) (interface{}, error) {
+	switch {
+	case to == reflect.TypeOf(Region{}) && from.Kind() == reflect.String:
+		return map[string]interface{}{"region": data}, nil
+	case to == reflect.TypeOf(Binding{}) && from.Kind() != reflect.Slice:
+		return []interface{}{data}, nil
+	case to == reflect.TypeOf(Region{}):
+		// YAML 1.1 reads a bare y as true, put it back.
+		switch m := data.(type) {
+		case map[string]interface{}:
+			if v, ok := m["true"]; ok {
+				m["y"] = v
+				delete(m, "true")
+			}
+		case map[interface{}]interface{}:
+			if v, ok := m[true]; ok {
+				m["y"] = v
+				delete(m, true)
+			}
+		}
+	}
+	return data, nil
+}
+
+// Bounds converts the binding of a light into the bounds it samples.
+// ok is false when the light has no binding.
+func (l Light) Bounds(id int) (bounds location.Bounds, ok bool, err error) {
+	binding, ok := l.Binding[id]
+	if !ok {
+		return nil, false, nil
+	}
+
+	for i, r := range binding {
+		b, err := l.bound(id, r)
+		if err != nil {
+			if len(binding) > 1 {
+				return nil, true, fmt.Errorf("region %d: %w", i+1, err)
+			}
+			return nil, true, err
+		}
+		bounds = append(bounds, b)
+	}
+	return bounds, true, nil
+}
+
+// Label is the name used for the light in logs.
+func (l Light) Label() string {
+	switch {
+	case l.Name != "":
+		return l.Name
+	case l.Type != "":
+		return l.Type
+	}
+	return "hue"
+}
+
+// SourceBounds groups the bounds of every binding and strip by the
+// label of the source they sample, ones without a source use first.
+func (l Light) SourceBounds(first string) (map[string]location.Bounds, error) {
+	bounds := make(map[string]location.Bounds)
+	source := func(s string) string {
+		if s == "" {
+			return first
+		}
+		return s
+	}
+
+	for _, id := range l.IDs() {
+		for _, r := range l.Binding[id] {
+			b, err := l.bound(id, r)
+			if err != nil {
+				return nil, fmt.Errorf("binding.%d: %w", id, err)
+			}
+			// Named regions can set the source for every binding using them.
+			s := r.Source
+			if named, ok := l.Regions[r.Name]; ok && s == "" {
+				s = named.Source
+			}
+			bounds[source(s)] = append(bounds[source(s)], b)
+		}
+	}
+
+	for i, s := range l.Strips {
+		b, err := s.bounds()
+		if err != nil {
+			return nil, fmt.Errorf("strips.%d: %w", i, err)
+		}
+		bounds[source(s.Source)] = append(bounds[source(s.Source)], b...)
+	}
+	return bounds, nil
+}
+
+// Layout returns how bound IDs map on to the pixels of a strip.
+func (l Light) Layout() sink.Layout {
+	return sink.Layout{Pixels: l.Pixels, Offset: l.Offset, Map: l.Pixel}
+}
+
+// BaudRate returns the adalight baud rate.
+func (l Light) BaudRate() int {
+	if l.Baud == 0 {
+		return 115200
+	}
+	return l.Baud
+}
+
+// RequestRate is how many hue_rest requests are sent a second.
+func (l Light) RequestRate() int {
+	if l.Rate == 0 {
+		return hue.MaxRate
+	}
+	return l.Rate
+}
+
+// TransitionTime is how long hue_rest lights fade between colors.
+func (l Light) TransitionTime() time.Duration {
+	if l.Transition == 0 {
+		return 100 * time.Millisecond
+	}
+	return l.Transition
+}
+
+// IDs returns every bound ID with a binding, in order.
+func (l Light) IDs() []int {
+	ids := make([]int, 0, len(l.Binding))
+	for id := range l.Binding {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// StripBounds converts every strip into the bounds of its segments.
+func (l Light) StripBounds() (location.Bounds, error) {
+	var bounds location.Bounds
+	for i, s := range l.Strips {
+		b, err := s.bounds()
+		if err != nil {
+			return nil, fmt.Errorf("strips.%d: %w", i, err)
+		}
+		bounds = append(bounds, b...)
+	}
+	return bounds, nil
+}
+
+func (s Strip) bounds() (location.Bounds, error) {
+	strip := location.Strip{
+		Count:   s.Count,
+		Depth:   s.Depth,
+		Gap:     s.Gap,
+		IDs:     s.IDs,
+		FirstID: s.FirstID,
+	}
+
+	// The perimeter is location's whole edge, other presets aren't edges.
+	switch s.Edge {
+	case "top":
+		strip.Edge = location.Top
+	case "bottom":
+		strip.Edge = location.Bottom
+	case "left":
+		strip.Edge = location.Left
+	case "right":
+		strip.Edge = location.Right
+	case "perimeter":
+		strip.Edge = location.Whole
+	default:
+		return nil, fmt.Errorf("edge: unknown edge %q, expected top, bottom, left, right or perimeter", s.Edge)
+	}
+	var err error
+	if strip.Start, err = location.ParsePreset(s.Start); err != nil {
+		return nil, fmt.Errorf("start: %w", err)
+	}
+	switch s.Direction {
+	case "", "clockwise":
+		strip.Direction = location.Clockwise
+	case "counterclockwise":
+		strip.Direction = location.CounterClockwise
+	default:
+		return nil, fmt.Errorf("direction: unknown direction %q, expected clockwise or counterclockwise", s.Direction)
+	}
+
+	return strip.Bounds()
+}
+
+// bound converts a single region, resolving names to light.regions
+// or presets.
+func (l Light) bound(id int, r Region) (location.Bound, error) {
+	var b location.Bound
+	kinds := 0
+
+	if r.Name != "" {
+		kinds++
+		if named, ok := l.Regions[r.Name]; ok {
+			if named.Name != "" {
+				return b, fmt.Errorf("region %q can't refer to another region", r.Name)
+			}
+			return l.bound(id, named)
+		}
+		preset, err := location.ParsePreset(r.Name)
+		if err != nil {
+			return b, err
+		}
+		b = location.Preset(id, preset)
+	}
+	if r.Width != 0 || r.Height != 0 {
+		kinds++
+		b = location.Bound{ID: id, X: r.X, Y: r.Y, Width: r.Width, Height: r.Height}
+	}
+	if len(r.Polygon) > 0 {
+		kinds++
+		b = location.Bound{ID: id}
+		for _, p := range r.Polygon {
+			b.Polygon = append(b.Polygon, location.Point{X: p[0], Y: p[1]})
+		}
+	}
+	if r.Segment != nil {
+		kinds++
+		if r.Segment.Depth <= 0 {
+			return b, fmt.Errorf("segment depth must be above 0")
+		}
+		from := location.Point{X: r.Segment.From[0], Y: r.Segment.From[1]}
+		to := location.Point{X: r.Segment.To[0], Y: r.Segment.To[1]}
+		for _, p := range []location.Point{from, to} {
+			if p.X < -1 || p.X > 1 || p.Y < -1 || p.Y > 1 {
+				return b, fmt.Errorf("segment point %v,%v is outside of -1 to 1", p.X, p.Y)
+			}
+		}
+		b = location.Segment(id, from, to, r.Segment.Depth)
+	}
+
+	switch kinds {
+	case 0:
+		return b, fmt.Errorf("needs a region name, width and height, polygon or segment")
+	case 1:
+		return b, b.Validate()
+	default:
+		return b, fmt.Errorf("only one of region name, width and height, polygon or segment can be set")
+	}
+}
+
+// validate checks a single light, prefix is where it is in the config.
+func (l Light) validate(prefix string, mqtt bool) Errors {
+	var errs Errors
+
+	if l.FPS < 0 {
+		errs = append(errs, fmt.Errorf("%s.fps: can't be negative", prefix))
+	}
+
+	switch l.Type {
+	case "", "hue":
+		if l.Bridge == "" {
+			errs = append(errs, fmt.Errorf("%s.bridge: is required", prefix))
+		}
+		if l.Username == "" || l.ClientKey == "" {
+			errs = append(errs, fmt.Errorf("%s.username and %[1]s.client_key: are required, run chromatic register --save", prefix))
+		}
+		switch {
+		case l.GroupID != 0 && l.GroupName != "":
+			errs = append(errs, fmt.Errorf("%s.group_id and %[1]s.group_name: only one can be set", prefix))
+		case l.GroupID == 0 && l.GroupName == "":
+			errs = append(errs, fmt.Errorf("%s.group_id or %[1]s.group_name: one is required", prefix))
+		}
+	case "hue_v2":
+		if l.Bridge == "" {
+			errs = append(errs, fmt.Errorf("%s.bridge: is required", prefix))
+		}
+		if l.Username == "" || l.ClientKey == "" {
+			errs = append(errs, fmt.Errorf("%s.username and %[1]s.client_key: are required, run chromatic register --save", prefix))
+		}
+		if l.Configuration == "" {
+			errs = append(errs, fmt.Errorf("%s.configuration: is required, run chromatic lights --v2 to list them", prefix))
+		}
+	case "hue_rest":
+		if l.Bridge == "" {
+			errs = append(errs, fmt.Errorf("%s.bridge: is required", prefix))
+		}
+		if l.Username == "" {
+			errs = append(errs, fmt.Errorf("%s.username: is required, run chromatic register --save", prefix))
+		}
+		if _, err := hue.NewREST(l.Bridge, l.Username, l.RequestRate(), l.TransitionTime()); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", prefix, err))
+		}
+	case "ddp", "wled", "e131":
+		if l.Address == "" && l.Type != "e131" {
+			errs = append(errs, fmt.Errorf("%s.address: is required", prefix))
+		}
+		if l.Type == "e131" && l.Universe < 1 {
+			errs = append(errs, fmt.Errorf("%s.universe: must be above 0", prefix))
+		}
+		if err := l.Layout().Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", prefix, err))
+		}
+	case "adalight":
+		if l.Serial == "" {
+			errs = append(errs, fmt.Errorf("%s.serial: is required", prefix))
+		}
+		if _, err := sink.NewAdalight(l.Serial, l.BaudRate(), l.Order, l.Layout()); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", prefix, err))
+		}
+	case "mqtt":
+		if !mqtt {
+			errs = append(errs, fmt.Errorf("%s.type: mqtt needs mqtt.broker to be set", prefix))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("%s.type: unknown type %q, expected hue, hue_v2, hue_rest, ddp, e131, wled, adalight or mqtt", prefix, l.Type))
+	}
+
+	for _, id := range l.IDs() {
+		if _, _, err := l.Bounds(id); err != nil {
+			errs = append(errs, fmt.Errorf("%s.binding.%d: %w", prefix, id, err))
+		}
+	}
+
+	// Ids are the sink's channels, a strip can't share one with a
+	// binding or another strip.
+	used := make(map[int]string)
+	for _, id := range l.IDs() {
+		used[id] = fmt.Sprintf("binding.%d", id)
+	}
+	for i, strip := range l.Strips {
+		bounds, err := strip.bounds()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s.strips.%d: %w", prefix, i, err))
+			continue
+		}
+		for _, b := range bounds {
+			if by, ok := used[b.ID]; ok {
+				errs = append(errs, fmt.Errorf("%s.strips.%d: id %d is already used by %s", prefix, i, b.ID, by))
+				continue
+			}
+			used[b.ID] = fmt.Sprintf("strips.%d", i)
+		}
+	}
+
+	names := make([]string, 0, len(l.Regions))
+	for name := range l.Regions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, err := l.bound(0, l.Regions[name]); err != nil {
+			errs = append(errs, fmt.Errorf("%s.regions.%s: %w", prefix, name, err))
+		}
+	}
+
+	return errs
+}
+
+// validateSources checks every region and strip samples a known source.
+func (l Light) validateSources(prefix string, sources map[string]bool) Errors {
+	var errs Errors
+	check := func(field, source string) {
+		if source != "" && !sources[source] {
+			errs = append(errs, fmt.Errorf("%s.%s.source: unknown source %q", prefix, field, source))
+		}
+	}
+
+	for _, id := range l.IDs() {
+		for _, r := range l.Binding[id] {
+			check(fmt.Sprintf("binding.%d", id), r.Source)
+		}
+	}
+	for i, s := range l.Strips {
+		check(fmt.Sprintf("strips.%d", i), s.Source)
+	}
+	names := make([]string, 0, len(l.Regions))
+	for name := range l.Regions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		check("regions."+name, l.Regions[name].Source)
+	}
+	return errs
+}
+
+// Validate checks the config for problems, returning Errors
+// when any are found.
+func (c *Config) Validate() error {
+	var errs Errors
+
+	if c.LogLevel != "" {
+		if _, err := logrus.ParseLevel(c.LogLevel); err != nil {
+			errs = append(errs, fmt.Errorf("log_level: %w", err))
+		}
+	}
+	if c.Bind == "" && c.Socket.Path == "" {
+		errs = append(errs, fmt.Errorf("bind or socket.path: one is required"))
+	}
+	if _, err := c.Socket.FileMode(); err != nil {
+		errs = append(errs, fmt.Errorf("socket.mode: %w", err))
+	}
+	if c.Socket.Path != "" && !strings.HasPrefix(c.Socket.Path, "/") {
+		errs = append(errs, fmt.Errorf("socket.path: must be absolute"))
+	}
+	errs = append(errs, c.validateAPI()...)
+
+	sources := make(map[string]bool)
+	switch {
+	case len(c.Sources) > 0 && c.Video != (Video{}):
+		errs = append(errs, fmt.Errorf("video and sources: only one can be set"))
+		for _, v := range c.Sources {
+			sources[v.Label()] = true
+		}
+	case len(c.Sources) > 0:
+		for i, v := range c.Sources {
+			errs = append(errs, v.validate(fmt.Sprintf("sources.%d", i))...)
+			if sources[v.Label()] {
+				errs = append(errs, fmt.Errorf("sources.%d.name: %q is already used", i, v.Label()))
+			}
+			sources[v.Label()] = true
+		}
+	default:
+		errs = append(errs, c.Video.validate("video")...)
+		sources[c.Video.Label()] = true
+	}
+
+	lights := c.Lights()
+	switch {
+	case len(c.Outputs) > 0 && !reflect.DeepEqual(c.Light, Light{}):
+		errs = append(errs, fmt.Errorf("light and outputs: only one can be set"))
+	case len(c.Outputs) > 0:
+		for i, l := range lights {
+			prefix := fmt.Sprintf("outputs.%d", i)
+			errs = append(errs, l.validate(prefix, c.MQTT.Broker != "")...)
+			errs = append(errs, l.validateSources(prefix, sources)...)
+		}
+	default:
+		errs = append(errs, c.Light.validate("light", c.MQTT.Broker != "")...)
+		errs = append(errs, c.Light.validateSources("light", sources)...)
+	}
+
+	if c.MQTT.Broker != "" {
+		if u, err := url.Parse(c.MQTT.Broker); err != nil || u.Host == "" {
+			errs = append(errs, fmt.Errorf("mqtt.broker: invalid url %q, expected something like tcp://localhost:1883", c.MQTT.Broker))
+		}
+	}
+	if c.MQTT.Interval < 0 {
+		errs = append(errs, fmt.Errorf("mqtt.interval: can't be negative"))
+	}
+	errs = append(errs, c.Rate.validate()...)
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
@@ -0,0 +1,439 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Khabi/chromatic/internal/api"
+	"github.com/Khabi/chromatic/internal/location"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+const valid = `
+bind: ":8080"
+log_level: info
+video:
+  device: /dev/video0
+  profile: 1280x720@30
+light:
+  bridge: 192.168.1.2
+  username: user
+  client_key: key
+  group_id: 1
+  binding:
+    1: top
+    2: left
+`
+
+func load(t *testing.T, yaml string) (*Config, error) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	assert.NoError(t, v.ReadConfig(strings.NewReader(yaml)))
+	return Load(v)
+}
+
+func TestLoad(t *testing.T) {
+	c, err := load(t, valid)
+	assert.NoError(t, err)
+	assert.Equal(t, "/dev/video0", c.Video.Device)
+	assert.Equal(t, "key", c.Light.ClientKey)
+	assert.Equal(t, map[int]Binding{1: {{Name: "top"}}, 2: {{Name: "left"}}}, c.Light.Binding)
+}
+
+const custom = `
+bind: ":8080"
+video:
+  device: /dev/video0
+  profile: 1280x720@30
+light:
+  bridge: 192.168.1.2
+  username: user
+  client_key: key
+  group_name: TV
+  regions:
+    tv-top: {x: 0, y: 1, width: 60, height: 10}
+  binding:
+    1: {x: 0.5, y: -0.5, width: 20, height: 10}
+    2: tv-top
+    3: tv-top
+    4: [top-left corner, left]
+    5:
+      polygon: [[-1, 1], [0, 1], [-1, 0]]
+    6:
+      segment: {from: [-1, -1], to: [1, -1], depth: 10}
+  strips:
+    - edge: top
+      start: top-right corner
+      count: 2
+      depth: 5
+      first_id: 20
+    - edge: perimeter
+      start: top-left corner
+      direction: counterclockwise
+      count: 4
+      depth: 5
+      ids: [30, 31, 32, 33]
+`
+
+func TestBounds(t *testing.T) {
+	c, err := load(t, custom)
+	assert.NoError(t, err)
+
+	var tests = []struct {
+		ID       int
+		Expected location.Bounds
+	}{
+		{1, location.Bounds{{ID: 1, X: 0.5, Y: -0.5, Width: 20, Height: 10}}},
+		{2, location.Bounds{{ID: 2, X: 0, Y: 1, Width: 60, Height: 10}}},
+		{3, location.Bounds{{ID: 3, X: 0, Y: 1, Width: 60, Height: 10}}},
+		{4, location.Bounds{location.Preset(4, location.TopLeft), location.Preset(4, location.Left)}},
+		{5, location.Bounds{{ID: 5, Polygon: []location.Point{{X: -1, Y: 1}, {X: 0, Y: 1}, {X: -1, Y: 0}}}}},
+		{6, location.Bounds{location.Segment(6, location.Point{X: -1, Y: -1}, location.Point{X: 1, Y: -1}, 10)}},
+	}
+
+	for _, td := range tests {
+		b, ok, err := c.Light.Bounds(td.ID)
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, td.Expected, b)
+	}
+
+	_, ok, err := c.Light.Bounds(7)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestStripBounds(t *testing.T) {
+	c, err := load(t, custom)
+	assert.NoError(t, err)
+
+	b, err := c.Light.StripBounds()
+	assert.NoError(t, err)
+	assert.Equal(t, location.Bounds{
+		{ID: 20, X: 0.5, Y: 1, Width: 50, Height: 5},
+		{ID: 21, X: -0.5, Y: 1, Width: 50, Height: 5},
+		{ID: 30, X: -1, Y: 0, Width: 5, Height: 100},
+		{ID: 31, X: 0, Y: -1, Width: 100, Height: 5},
+		{ID: 32, X: 1, Y: 0, Width: 5, Height: 100},
+		{ID: 33, X: 0, Y: 1, Width: 100, Height: 5},
+	}, b)
+}
+
+func TestValidateRegions(t *testing.T) {
+	var tests = []struct {
+		name     string
+		replace  [2]string
+		expected string
+	}{
+		{"out of range", [2]string{"x: 0.5", "x: 1.5"}, "light.binding.1: centerpoint 1.5,-0.5 is outside of -1 to 1"},
+		{"too big", [2]string{"width: 20", "width: 120"}, "light.binding.1: size 120x10 is outside of 0 to 100%"},
+		{"unknown region", [2]string{"3: tv-top", "3: tv-bottom"}, `light.binding.3: unknown preset "tv-bottom", expected one of top, bottom, left, right, whole, top-left corner, top-right corner, bottom-left corner, bottom-right corner`},
+		{"bad list entry", [2]string{"[top-left corner, left]", "[top-left corner, {x: 2, y: 0, width: 5, height: 5}]"}, "light.binding.4: region 2: centerpoint 2,0 is outside of -1 to 1"},
+		{"short polygon", [2]string{"[0, 1], [-1, 0]]", "[0, 1]]"}, "light.binding.5: polygon needs at least 3 points, has 2"},
+		{"segment depth", [2]string{"depth: 10", "depth: 0"}, "light.binding.6: segment depth must be above 0"},
+		{"ambiguous", [2]string{"segment: {", "polygon: [[0, 0], [1, 0], [1, 1]]\n      segment: {"}, "light.binding.6: only one of region name, width and height, polygon or segment can be set"},
+		{"strip edge", [2]string{"edge: top", "edge: middle"}, `light.strips.0: edge: unknown edge "middle", expected top, bottom, left, right or perimeter`},
+		{"strip whole", [2]string{"edge: top", "edge: whole"}, `light.strips.0: edge: unknown edge "whole", expected top, bottom, left, right or perimeter`},
+		{"strip binding id", [2]string{"first_id: 20", "first_id: 6"}, "light.strips.0: id 6 is already used by binding.6"},
+		{"strip strip id", [2]string{"ids: [30, 31, 32, 33]", "ids: [30, 21, 32, 33]"}, "light.strips.1: id 21 is already used by strips.0"},
+		{"strip corner", [2]string{"start: top-right corner", "start: bottom-right corner"}, "light.strips.0: start corner bottom-right corner is not on the top edge"},
+		{"strip direction", [2]string{"direction: counterclockwise", "direction: up"}, `light.strips.1: direction: unknown direction "up", expected clockwise or counterclockwise`},
+		{"strip ids", [2]string{"[30, 31, 32, 33]", "[30, 31]"}, "light.strips.1: has 2 ids for 4 segments"},
+		{"bad shared region", [2]string{"height: 10}\n  binding", "height: 0}\n  binding"}, "light.binding.2: size 60x0 is outside of 0 to 100%\nlight.binding.3: size 60x0 is outside of 0 to 100%\nlight.regions.tv-top: size 60x0 is outside of 0 to 100%"},
+	}
+
+	for _, td := range tests {
+		t.Run(td.name, func(t *testing.T) {
+			_, err := load(t, strings.Replace(custom, td.replace[0], td.replace[1], 1))
+			assert.EqualError(t, err, td.expected)
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	var tests = []struct {
+		name     string
+		replace  [2]string
+		expected string
+	}{
+		{"bad profile", [2]string{"1280x720@30", "720p"}, `video.profile: invalid profile "720p", expected WIDTHxHEIGHT@FPS like 1280x720@30`},
+		{"zero fps", [2]string{"1280x720@30", "1280x720@0"}, `video.profile: invalid profile "1280x720@0", width, height and fps must be above 0`},
+		{"dc decode", [2]string{"profile: 1280x720@30", "profile: 1280x720@30\n  decode: dc"}, ""},
+		{"dc decode yuyv", [2]string{"profile: 1280x720@30", "profile: 1280x720@30:yuyv\n  decode: dc"}, "video.decode: dc only works with mjpeg, yuyv frames aren't compressed"},
+		{"bad decode", [2]string{"profile: 1280x720@30", "profile: 1280x720@30\n  decode: fast"}, `video.decode: unknown decode mode "fast", expected full or dc`},
+		{"unknown preset", [2]string{"2: left", "2: middle"}, `light.binding.2: unknown preset "middle", expected one of top, bottom, left, right, whole, top-left corner, top-right corner, bottom-left corner, bottom-right corner`},
+		{"missing credentials", [2]string{"client_key: key", ""}, "light.username and light.client_key: are required, run chromatic register --save"},
+		{"conflicting group", [2]string{"group_id: 1", "group_id: 1\n  group_name: TV"}, "light.group_id and light.group_name: only one can be set"},
+		{"missing group", [2]string{"group_id: 1", ""}, "light.group_id or light.group_name: one is required"},
+		{"hue v2", [2]string{"group_id: 1", "type: hue_v2\n  configuration: TV area"}, ""},
+		{"hue v2 configuration", [2]string{"group_id: 1", "type: hue_v2"}, "light.configuration: is required, run chromatic lights --v2 to list them"},
+		{"hue rest", [2]string{"group_id: 1", "type: hue_rest\n  rate: 5\n  transition: 1s"}, ""},
+		{"hue rest username", [2]string{"username: user", "type: hue_rest"}, "light.username: is required, run chromatic register --save"},
+		{"hue rest rate", [2]string{"group_id: 1", "type: hue_rest\n  rate: 20"}, "light: rate 20 is outside of 1 to 10"},
+		{"mqtt broker", [2]string{"log_level: info", "mqtt:\n  broker: localhost"}, `mqtt.broker: invalid url "localhost", expected something like tcp://localhost:1883`},
+		{"bad log level", [2]string{"log_level: info", "log_level: loud"}, `log_level: not a valid logrus Level: "loud"`},
+		{"socket", [2]string{`bind: ":8080"`, "socket:\n  path: /run/chromatic.sock\n  mode: 0600\n  group: video"}, ""},
+		{"socket mode", [2]string{"log_level: info", "socket:\n  path: /run/chromatic.sock\n  mode: 660"}, "socket.mode: invalid mode 660, expected permissions like 0660"},
+		{"relative socket", [2]string{"log_level: info", "socket:\n  path: chromatic.sock"}, "socket.path: must be absolute"},
+		{"no api", [2]string{`bind: ":8080"`, ""}, "bind or socket.path: one is required"},
+		{"tokens", [2]string{"log_level: info", "tokens:\n  - token: abc\n  - token: def\n    scope: control"}, ""},
+		{"empty token", [2]string{"log_level: info", "tokens:\n  - scope: read"}, "tokens.0.token: is required"},
+		{"duplicate token", [2]string{"log_level: info", "tokens:\n  - token: abc\n  - token: abc"}, "tokens.1.token: is already used"},
+		{"token scope", [2]string{"log_level: info", "tokens:\n  - token: abc\n    scope: admin"}, `tokens.0.scope: unknown scope "admin", expected read or control`},
+		{"tokens need bind", [2]string{`bind: ":8080"`, "socket:\n  path: /run/chromatic.sock\ntokens:\n  - token: abc"}, "bind: is required for tokens, tls and allow"},
+		{"tls", [2]string{"log_level: info", "tls:\n  cert: /etc/chromatic/cert.pem\n  key: /etc/chromatic/key.pem"}, ""},
+		{"tls key", [2]string{"log_level: info", "tls:\n  cert: /etc/chromatic/cert.pem"}, "tls.cert and tls.key: both are required"},
+		{"self signed", [2]string{"log_level: info", "tls:\n  self_signed: true"}, ""},
+		{"self signed key", [2]string{"log_level: info", "tls:\n  self_signed: true\n  key: /etc/chromatic/key.pem"}, "tls.cert and tls.key: both or neither are needed to keep a self signed certificate"},
+		{"allow", [2]string{"log_level: info", "allow: [192.168.1.0/24, 10.0.0.5, \"::1\"]"}, ""},
+		{"bad allow", [2]string{"log_level: info", "allow: [192.168.1.0/33]"}, `allow.0: invalid address "192.168.1.0/33", expected an ip or cidr like 192.168.1.0/24`},
+		{"rate", [2]string{"log_level: info", "rate:\n  capture: 20\n  output: 25\n  adaptive: true\n  max_cpu: 70"}, ""},
+		{"negative rate", [2]string{"log_level: info", "rate:\n  capture: -1"}, "rate.capture: can't be negative"},
+		{"max cpu", [2]string{"log_level: info", "rate:\n  max_cpu: 0.8"}, ""},
+		{"max cpu range", [2]string{"log_level: info", "rate:\n  max_cpu: 120"}, "rate.max_cpu: 120 is outside of 0 to 100%"},
+		{"light fps", [2]string{"group_id: 1", "group_id: 1\n  fps: -5"}, "light.fps: can't be negative"},
+	}
+
+	for _, td := range tests {
+		t.Run(td.name, func(t *testing.T) {
+			_, err := load(t, strings.Replace(valid, td.replace[0], td.replace[1], 1))
+			if td.expected == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, td.expected)
+		})
+	}
+}
+
+func TestAPI(t *testing.T) {
+	c, err := load(t, strings.Replace(valid, "log_level: info", "socket:\n  path: /run/chromatic.sock\n  mode: \"0600\"", 1))
+	assert.NoError(t, err)
+	assert.Equal(t, api.Options{Bind: ":8080", Socket: "/run/chromatic.sock", SocketMode: 0600}, c.API())
+
+	c, err = load(t, valid)
+	assert.NoError(t, err)
+	assert.Equal(t, api.Options{Bind: ":8080", SocketMode: 0660}, c.API())
+
+	c, err = load(t, strings.Replace(valid, "log_level: info", "tokens:\n  - token: abc\n  - token: def\n    scope: control\ntls:\n  self_signed: true\nallow: [192.168.1.0/24, 10.0.0.5]", 1))
+	assert.NoError(t, err)
+	opts := c.API()
+	assert.Equal(t, []api.Token{{Value: "abc", Scope: api.ScopeRead}, {Value: "def", Scope: api.ScopeControl}}, opts.Tokens)
+	assert.True(t, opts.TLS())
+	assert.Equal(t, []string{"192.168.1.0/24", "10.0.0.5/32"}, []string{opts.Allow[0].String(), opts.Allow[1].String()})
+}
+
+func TestOutputRate(t *testing.T) {
+	var tests = []struct {
+		name     string
+		rate     Rate
+		light    Light
+		expected float64
+	}{
+		{"hue", Rate{}, Light{}, 25},
+		{"hue v2", Rate{}, Light{Type: "hue_v2"}, 25},
+		{"strip", Rate{}, Light{Type: "wled"}, 0},
+		{"global", Rate{Output: 30}, Light{Type: "hue_v2"}, 30},
+		{"light", Rate{Output: 30}, Light{Type: "wled", FPS: 60}, 60},
+	}
+
+	for _, td := range tests {
+		t.Run(td.name, func(t *testing.T) {
+			c := Config{Rate: td.rate}
+			assert.Equal(t, td.expected, c.OutputRate(td.light))
+		})
+	}
+}
+
+func TestValidateStrip(t *testing.T) {
+	strip := `
+bind: ":8080"
+video:
+  device: /dev/video0
+  profile: 1280x720@30
+light:
+  type: wled
+  address: 192.168.1.50
+  pixels: 30
+  pixel:
+    1: [0, 1, 2]
+  binding:
+    1: top
+`
+	c, err := load(t, strip)
+	assert.NoError(t, err)
+	assert.Equal(t, map[int][]int{1: {0, 1, 2}}, c.Light.Layout().Map)
+
+	var tests = []struct {
+		name     string
+		replace  [2]string
+		expected string
+	}{
+		{"unknown type", [2]string{"type: wled", "type: dmx"}, `light.type: unknown type "dmx", expected hue, hue_v2, hue_rest, ddp, e131, wled, adalight or mqtt`},
+		{"missing address", [2]string{"address: 192.168.1.50", ""}, "light.address: is required"},
+		{"e131 universe", [2]string{"type: wled", "type: e131"}, "light.universe: must be above 0"},
+		{"pixel out of range", [2]string{"[0, 1, 2]", "[0, 30]"}, "light: bound 1 maps to pixel 30, outside of 0 to 29"},
+		{"adalight serial", [2]string{"type: wled", "type: adalight"}, "light.serial: is required"},
+		{"adalight order", [2]string{"type: wled", "type: adalight\n  serial: /dev/ttyUSB0\n  order: bgrw"}, `light: unknown color order "bgrw", expected something like rgb or grb`},
+	}
+
+	for _, td := range tests {
+		t.Run(td.name, func(t *testing.T) {
+			_, err := load(t, strings.Replace(strip, td.replace[0], td.replace[1], 1))
+			assert.EqualError(t, err, td.expected)
+		})
+	}
+}
+
+func TestValidateOutputs(t *testing.T) {
+	outputs := `
+bind: ":8080"
+video:
+  device: /dev/video0
+  profile: 1280x720@30
+mqtt:
+  broker: tcp://localhost:1883
+outputs:
+  - name: living room
+    bridge: 192.168.1.2
+    username: user
+    client_key: key
+    group_id: 1
+    binding:
+      1: top
+  - type: wled
+    address: 192.168.1.50
+    pixels: 30
+    pixel:
+      1: [0, 1, 2]
+    binding:
+      1: left
+  - type: mqtt
+    binding:
+      1: whole
+`
+	c, err := load(t, outputs)
+	assert.NoError(t, err)
+	lights := c.Lights()
+	assert.Len(t, lights, 3)
+	assert.Equal(t, "living room", lights[0].Label())
+	assert.Equal(t, "wled", lights[1].Label())
+	assert.Equal(t, map[int]Binding{1: {{Name: "left"}}}, lights[1].Binding)
+
+	var tests = []struct {
+		name     string
+		replace  [2]string
+		expected string
+	}{
+		{"both", [2]string{"outputs:", "light:\n  group_id: 2\noutputs:"}, "light and outputs: only one can be set"},
+		{"prefix", [2]string{"address: 192.168.1.50", ""}, "outputs.1.address: is required"},
+		{"binding", [2]string{"1: whole", "1: middle"}, `outputs.2.binding.1: unknown preset "middle", expected one of top, bottom, left, right, whole, top-left corner, top-right corner, bottom-left corner, bottom-right corner`},
+		{"mqtt broker", [2]string{"broker: tcp://localhost:1883", ""}, "outputs.2.type: mqtt needs mqtt.broker to be set"},
+	}
+
+	for _, td := range tests {
+		t.Run(td.name, func(t *testing.T) {
+			_, err := load(t, strings.Replace(outputs, td.replace[0], td.replace[1], 1))
+			assert.EqualError(t, err, td.expected)
+		})
+	}
+}
+
+func TestSources(t *testing.T) {
+	sources := `
+bind: ":8080"
+sources:
+  - name: tv
+    device: /dev/video0
+    profile: 1280x720@30
+  - device: /dev/video2
+    profile: 640x480@30
+light:
+  bridge: 192.168.1.2
+  username: user
+  client_key: key
+  group_id: 1
+  regions:
+    monitor-top: {x: 0, y: 1, width: 60, height: 10, source: /dev/video2}
+  binding:
+    1: top
+    2: {region: left, source: /dev/video2}
+    3: [right, monitor-top]
+  strips:
+    - edge: bottom
+      start: bottom-left corner
+      count: 2
+      depth: 10
+      first_id: 10
+      source: tv
+`
+	c, err := load(t, sources)
+	assert.NoError(t, err)
+	videos := c.Videos()
+	assert.Len(t, videos, 2)
+	assert.Equal(t, "tv", videos[0].Label())
+	assert.Equal(t, "/dev/video2", videos[1].Label())
+
+	bounds, err := c.Light.SourceBounds("tv")
+	assert.NoError(t, err)
+	ids := func(b location.Bounds) []int {
+		var ids []int
+		for _, bound := range b {
+			ids = append(ids, bound.ID)
+		}
+		return ids
+	}
+	assert.Equal(t, []int{1, 3, 10, 11}, ids(bounds["tv"]))
+	assert.Equal(t, []int{2, 3}, ids(bounds["/dev/video2"]))
+
+	var tests = []struct {
+		name     string
+		replace  [2]string
+		expected string
+	}{
+		{"both", [2]string{"sources:", "video:\n  device: /dev/video1\nsources:"}, "video and sources: only one can be set"},
+		{"prefix", [2]string{"640x480@30", "vga"}, `sources.1.profile: invalid profile "vga", expected WIDTHxHEIGHT@FPS like 1280x720@30`},
+		{"duplicate", [2]string{"- device: /dev/video2", "- name: tv\n    device: /dev/video2"}, "sources.1.name: \"tv\" is already used\nlight.binding.2.source: unknown source \"/dev/video2\"\nlight.regions.monitor-top.source: unknown source \"/dev/video2\""},
+		{"unknown source", [2]string{"source: tv", "source: monitor"}, `light.strips.0.source: unknown source "monitor"`},
+		{"unknown region source", [2]string{"source: /dev/video2}\n  binding", "source: hdmi}\n  binding"}, `light.regions.monitor-top.source: unknown source "hdmi"`},
+	}
+
+	for _, td := range tests {
+		t.Run(td.name, func(t *testing.T) {
+			_, err := load(t, strings.Replace(sources, td.replace[0], td.replace[1], 1))
+			assert.EqualError(t, err, td.expected)
+		})
+	}
+}
+
+func TestParseProfile(t *testing.T) {
+	p, err := ParseProfile("1920x1080@60")
+	assert.NoError(t, err)
+	assert.Equal(t, Profile{Width: 1920, Height: 1080, FPS: 60}, p)
+
+	p, err = ParseProfile("640x480@30:yuyv")
+	assert.NoError(t, err)
+	assert.Equal(t, Profile{Width: 640, Height: 480, FPS: 30, Format: "yuyv"}, p)
+
+	p, err = ParseProfile("1280x720@30000/1001:nv12")
+	assert.NoError(t, err)
+	assert.Equal(t, Profile{Width: 1280, Height: 720, FPS: 30000, Per: 1001, Format: "nv12"}, p)
+	assert.InDelta(t, 29.97, p.Rate(), 0.001)
+
+	for _, s := range []string{"1920x1080@60", "1280x720@30000/1001:nv12", "640x480@30:yuyv"} {
+		p, err := ParseProfile(s)
+		assert.NoError(t, err)
+		assert.Equal(t, s, p.String())
+	}
+	assert.Equal(t, "640x480@30", Profile{Width: 640, Height: 480, FPS: 30, Per: 1, Format: "mjpeg"}.String())
+
+	_, err = ParseProfile("1280x720@30/0")
+	assert.EqualError(t, err, `invalid profile "1280x720@30/0", fps can't be divided by 0`)
+
+	_, err = ParseProfile("1920x1080@60fps")
+	assert.Error(t, err)
+
+	_, err = ParseProfile("640x480@30:h264")
+	assert.EqualError(t, err, `unknown format "h264", expected mjpeg, yuyv or nv12`)
+}
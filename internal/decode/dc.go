@@ -0,0 +1,520 @@
+package decode
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+)
+
+// errUnsupported marks jpegs decodeDC doesn't handle, they are still
+// valid images.
+var errUnsupported = errors.New("unsupported jpeg")
+
+// jpeg markers, see section B.1.1.3 of the spec.
+const (
+	markerSOF0 = 0xc0 // baseline
+	markerSOF1 = 0xc1 // extended sequential, huffman coded
+	markerDHT  = 0xc4
+	markerRST0 = 0xd0
+	markerRST7 = 0xd7
+	markerSOI  = 0xd8
+	markerEOI  = 0xd9
+	markerSOS  = 0xda
+	markerDQT  = 0xdb
+	markerDRI  = 0xdd
+	markerAPPE = 0xee // adobe, says whether the colors are rgb
+)
+
+type component struct {
+	id   byte
+	h, v int // sampling factors
+	tq   byte
+	td   byte // huffman tables, set by the scan
+	ta   byte
+	pred int32 // last DC coefficient
+}
+
+// dcDecoder holds the state of a jpeg up to and including its scan.
+type dcDecoder struct {
+	width, height int
+	comps         []component
+	quant         [4]uint16 // the DC entry of each quantization table
+	dc, ac        [4]*huffman
+	restart       int
+	adobe         bool
+	transform     byte
+}
+
+// decodeDC decodes the DC coefficients of a baseline jpeg into an image
+// an eighth of its size.
+func decodeDC(b []byte) (image.Image, error) {
+	if len(b) < 2 || b[0] != 0xff || b[1] != markerSOI {
+		return nil, fmt.Errorf("%w: missing SOI marker", errUnsupported)
+	}
+
+	d := &dcDecoder{}
+	pos := 2
+	for {
+		// Markers can be padded with any number of 0xff.
+		for pos < len(b) && b[pos] != 0xff {
+			pos++
+		}
+		for pos < len(b) && b[pos] == 0xff {
+			pos++
+		}
+		if pos >= len(b) {
+			return nil, errors.New("jpeg ended before its scan")
+		}
+		marker := b[pos]
+		pos++
+
+		if marker == markerEOI {
+			return nil, errors.New("jpeg ended before its scan")
+		}
+		if marker >= markerRST0 && marker <= markerRST7 || marker == 0x01 {
+			continue // markers without a segment
+		}
+		if pos+2 > len(b) {
+			return nil, errors.New("truncated jpeg segment")
+		}
+		n := int(binary.BigEndian.Uint16(b[pos:]))
+		if n < 2 || pos+n > len(b) {
+			return nil, errors.New("truncated jpeg segment")
+		}
+		seg := b[pos+2 : pos+n]
+		pos += n
+
+		var err error
+		switch {
+		case marker == markerSOF0 || marker == markerSOF1:
+			err = d.frame(seg)
+		case marker == markerDHT:
+			err = d.huffmanTables(seg)
+		case marker == markerDQT:
+			err = d.quantTables(seg)
+		case marker == markerDRI:
+			if len(seg) != 2 {
+				return nil, errors.New("invalid DRI segment")
+			}
+			d.restart = int(binary.BigEndian.Uint16(seg))
+		case marker == markerAPPE:
+			if len(seg) >= 12 && string(seg[:5]) == "Adobe" {
+				d.adobe, d.transform = true, seg[11]
+			}
+		case marker == markerSOS:
+			return d.scan(seg, b[pos:])
+		case marker >= 0xc0 && marker <= 0xcf && marker != 0xc8 && marker != 0xcc:
+			// Progressive, lossless and arithmetic coded frames.
+			return nil, fmt.Errorf("%w: SOF marker %#x", errUnsupported, marker)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// frame reads the SOF segment.
+func (d *dcDecoder) frame(seg []byte) error {
+	if d.comps != nil {
+		return errors.New("more than one SOF marker")
+	}
+	if len(seg) < 6 {
+		return errors.New("invalid SOF segment")
+	}
+	if seg[0] != 8 {
+		return fmt.Errorf("%w: %d bit precision", errUnsupported, seg[0])
+	}
+	d.height = int(binary.BigEndian.Uint16(seg[1:]))
+	d.width = int(binary.BigEndian.Uint16(seg[3:]))
+	if d.height == 0 || d.width == 0 {
+		return fmt.Errorf("%w: size set by a DNL marker", errUnsupported)
+	}
+
+	n := int(seg[5])
+	if n != 1 && n != 3 {
+		return fmt.Errorf("%w: %d components", errUnsupported, n)
+	}
+	if len(seg) != 6+3*n {
+		return errors.New("invalid SOF segment")
+	}
+	for i := 0; i < n; i++ {
+		c := seg[6+3*i:]
+		comp := component{id: c[0], h: int(c[1] >> 4), v: int(c[1] & 0x0f), tq: c[2]}
+		if comp.h < 1 || comp.h > 4 || comp.v < 1 || comp.v > 4 || comp.tq > 3 {
+			return errors.New("invalid SOF component")
+		}
+		d.comps = append(d.comps, comp)
+	}
+	return nil
+}
+
+// quantTables reads a DQT segment, only the DC entry is kept.
+func (d *dcDecoder) quantTables(seg []byte) error {
+	for len(seg) > 0 {
+		pq, tq := seg[0]>>4, seg[0]&0x0f
+		if tq > 3 {
+			return errors.New("invalid DQT segment")
+		}
+		switch {
+		case pq == 0 && len(seg) >= 65:
+			d.quant[tq] = uint16(seg[1])
+			seg = seg[65:]
+		case pq == 1 && len(seg) >= 129:
+			d.quant[tq] = binary.BigEndian.Uint16(seg[1:])
+			seg = seg[129:]
+		default:
+			return errors.New("invalid DQT segment")
+		}
+	}
+	return nil
+}
+
+// huffmanTables reads a DHT segment.
+func (d *dcDecoder) huffmanTables(seg []byte) error {
+	for len(seg) > 0 {
+		if len(seg) < 17 {
+			return errors.New("invalid DHT segment")
+		}
+		tc, th := seg[0]>>4, seg[0]&0x0f
+		if tc > 1 || th > 3 {
+			return errors.New("invalid DHT segment")
+		}
+		var counts [16]byte
+		copy(counts[:], seg[1:17])
+		total := 0
+		for _, c := range counts {
+			total += int(c)
+		}
+		if len(seg) < 17+total {
+			return errors.New("invalid DHT segment")
+		}
+
+		h, err := newHuffman(counts, seg[17:17+total])
+		if err != nil {
+			return err
+		}
+		if tc == 0 {
+			d.dc[th] = h
+		} else {
+			d.ac[th] = h
+		}
+		seg = seg[17+total:]
+	}
+	return nil
+}
+
+// scan reads the SOS segment and decodes the entropy coded data after it.
+func (d *dcDecoder) scan(seg, data []byte) (image.Image, error) {
+	if d.comps == nil {
+		return nil, errors.New("missing SOF marker")
+	}
+	if len(seg) < 1 || len(seg) != 4+2*int(seg[0]) {
+		return nil, errors.New("invalid SOS segment")
+	}
+	// A frame split across several scans needs every scan decoded.
+	if int(seg[0]) != len(d.comps) {
+		return nil, fmt.Errorf("%w: non-interleaved scan", errUnsupported)
+	}
+	if d.adobe && d.transform == 0 && len(d.comps) == 3 {
+		return nil, fmt.Errorf("%w: rgb colors", errUnsupported)
+	}
+
+	for i := range d.comps {
+		c := seg[1+2*i:]
+		if c[0] != d.comps[i].id {
+			return nil, fmt.Errorf("%w: scan components out of order", errUnsupported)
+		}
+		d.comps[i].td, d.comps[i].ta = c[1]>>4, c[1]&0x0f
+		if d.comps[i].td > 3 || d.comps[i].ta > 3 {
+			return nil, errors.New("invalid SOS segment")
+		}
+		// Motion jpeg leaves out the tables and expects the standard ones.
+		if d.dc[d.comps[i].td] == nil {
+			d.dc[d.comps[i].td] = standardDC[min(int(d.comps[i].td), 1)]
+		}
+		if d.ac[d.comps[i].ta] == nil {
+			d.ac[d.comps[i].ta] = standardAC[min(int(d.comps[i].ta), 1)]
+		}
+	}
+
+	if len(d.comps) == 1 {
+		return d.gray(data)
+	}
+	return d.color(data)
+}
+
+// gray decodes a single component, which is always one block at a time
+// whatever its sampling factors.
+func (d *dcDecoder) gray(data []byte) (image.Image, error) {
+	bx, by := (d.width+7)/8, (d.height+7)/8
+	img := image.NewGray(image.Rect(0, 0, bx, by))
+	r := &bitReader{data: data}
+	c := &d.comps[0]
+
+	for i := 0; i < bx*by; i++ {
+		if err := d.restartAt(r, i); err != nil {
+			return nil, err
+		}
+		v, err := d.block(r, c)
+		if err != nil {
+			return nil, err
+		}
+		img.Pix[i/bx*img.Stride+i%bx] = v
+	}
+	if r.eof {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return img, nil
+}
+
+// color decodes three interleaved components into a YCbCr image.
+func (d *dcDecoder) color(data []byte) (image.Image, error) {
+	y, cb, cr := &d.comps[0], &d.comps[1], &d.comps[2]
+	if cb.h != cr.h || cb.v != cr.v || y.h%cb.h != 0 || y.v%cb.v != 0 {
+		return nil, fmt.Errorf("%w: sampling factors", errUnsupported)
+	}
+	var ratio image.YCbCrSubsampleRatio
+	switch [2]int{y.h / cb.h, y.v / cb.v} {
+	case [2]int{1, 1}:
+		ratio = image.YCbCrSubsampleRatio444
+	case [2]int{2, 1}:
+		ratio = image.YCbCrSubsampleRatio422
+	case [2]int{2, 2}:
+		ratio = image.YCbCrSubsampleRatio420
+	case [2]int{1, 2}:
+		ratio = image.YCbCrSubsampleRatio440
+	case [2]int{4, 1}:
+		ratio = image.YCbCrSubsampleRatio411
+	case [2]int{4, 2}:
+		ratio = image.YCbCrSubsampleRatio410
+	default:
+		return nil, fmt.Errorf("%w: sampling factors", errUnsupported)
+	}
+
+	// Each plane is a whole number of MCUs, the image is cropped to the
+	// frame afterwards.
+	mx := (d.width + 8*y.h - 1) / (8 * y.h)
+	my := (d.height + 8*y.v - 1) / (8 * y.v)
+	img := image.NewYCbCr(image.Rect(0, 0, mx*y.h, my*y.v), ratio)
+	r := &bitReader{data: data}
+
+	for i := 0; i < mx*my; i++ {
+		if err := d.restartAt(r, i); err != nil {
+			return nil, err
+		}
+		for n, plane := range [][]byte{img.Y, img.Cb, img.Cr} {
+			c := &d.comps[n]
+			stride := img.CStride
+			if n == 0 {
+				stride = img.YStride
+			}
+			for v := 0; v < c.v; v++ {
+				for h := 0; h < c.h; h++ {
+					p, err := d.block(r, c)
+					if err != nil {
+						return nil, err
+					}
+					plane[(i/mx*c.v+v)*stride+i%mx*c.h+h] = p
+				}
+			}
+		}
+	}
+	if r.eof {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return img.SubImage(image.Rect(0, 0, (d.width+7)/8, (d.height+7)/8)), nil
+}
+
+// restartAt handles the restart marker before MCU i.
+func (d *dcDecoder) restartAt(r *bitReader, i int) error {
+	if d.restart == 0 || i == 0 || i%d.restart != 0 {
+		return nil
+	}
+	if err := r.restart(); err != nil {
+		return err
+	}
+	for n := range d.comps {
+		d.comps[n].pred = 0
+	}
+	return nil
+}
+
+// block decodes a block's DC coefficient and skips the rest, returning
+// the average value of its pixels.
+func (d *dcDecoder) block(r *bitReader, c *component) (byte, error) {
+	s, err := r.decode(d.dc[c.td])
+	if err != nil {
+		return 0, err
+	}
+	if s > 11 {
+		return 0, errors.New("invalid DC coefficient size")
+	}
+	c.pred += r.receive(uint(s))
+
+	ac := d.ac[c.ta]
+	for k := 1; k < 64; {
+		rs, err := r.decode(ac)
+		if err != nil {
+			return 0, err
+		}
+		run, size := int(rs>>4), uint(rs&0x0f)
+		if size == 0 {
+			if run != 15 {
+				break // end of block
+			}
+			k += 16
+			continue
+		}
+		k += run + 1
+		r.skip(size)
+	}
+
+	// The DC coefficient is eight times the mean of the level shifted
+	// pixels.
+	v := 128 + (c.pred*int32(d.quant[c.tq])+4)>>3
+	switch {
+	case v < 0:
+		return 0, nil
+	case v > 255:
+		return 255, nil
+	}
+	return byte(v), nil
+}
+
+// bitReader reads entropy coded data, it stops at the first marker and
+// reads zeros from there.
+type bitReader struct {
+	data   []byte
+	pos    int
+	acc    uint32 // the next bits, most significant first
+	n      uint   // number of bits in acc
+	marker bool   // pos is at a marker
+	eof    bool   // the data ended without a marker
+}
+
+// fill tops acc up to at least 25 bits.
+func (r *bitReader) fill() {
+	for r.n <= 24 {
+		var c byte
+		if !r.marker && r.pos < len(r.data) {
+			c = r.data[r.pos]
+			if c != 0xff {
+				r.pos++
+			} else if r.pos+1 < len(r.data) && r.data[r.pos+1] == 0x00 {
+				r.pos += 2 // stuffed byte
+			} else {
+				r.marker, c = true, 0
+			}
+		} else if !r.marker {
+			r.eof = true
+		}
+		r.acc |= uint32(c) << (24 - r.n)
+		r.n += 8
+	}
+}
+
+// skip drops up to 16 bits.
+func (r *bitReader) skip(n uint) {
+	r.fill()
+	r.acc <<= n
+	r.n -= n
+}
+
+// receive reads an n bit signed value, see section F.2.2.1 of the spec.
+func (r *bitReader) receive(n uint) int32 {
+	if n == 0 {
+		return 0
+	}
+	r.fill()
+	v := int32(r.acc >> (32 - n))
+	r.acc <<= n
+	r.n -= n
+	if v < 1<<(n-1) {
+		v += -1<<n + 1
+	}
+	return v
+}
+
+// decode reads a huffman coded value.
+func (r *bitReader) decode(h *huffman) (byte, error) {
+	r.fill()
+	if e := h.lut[r.acc>>(32-lutBits)]; e != 0 {
+		r.acc <<= e & 0xff
+		r.n -= uint(e & 0xff)
+		return byte(e >> 8), nil
+	}
+
+	code := int32(0)
+	for l := 1; l <= 16; l++ {
+		code = code<<1 | int32(r.acc>>31)
+		r.acc <<= 1
+		r.n--
+		if code <= h.maxCode[l] {
+			return h.vals[h.valPtr[l]+code-h.minCode[l]], nil
+		}
+	}
+	return 0, errors.New("invalid huffman code")
+}
+
+// restart drops what is left of the current interval and moves past the
+// next restart marker.
+func (r *bitReader) restart() error {
+	for ; r.pos+1 < len(r.data); r.pos++ {
+		if r.data[r.pos] == 0xff && r.data[r.pos+1] >= markerRST0 && r.data[r.pos+1] <= markerRST7 {
+			r.pos += 2
+			r.acc, r.n, r.marker = 0, 0, false
+			return nil
+		}
+	}
+	return errors.New("missing restart marker")
+}
+
+// lutBits is how many bits are looked up at once, longer codes are
+// decoded a bit at a time.
+const lutBits = 9
+
+// huffman is a huffman table, see section F.2.2.3 of the spec.
+type huffman struct {
+	lut     [1 << lutBits]uint16 // value<<8 | length, 0 for longer codes
+	vals    []byte
+	minCode [17]int32
+	maxCode [17]int32 // -1 when there are no codes of a length
+	valPtr  [17]int32
+}
+
+func newHuffman(counts [16]byte, vals []byte) (*huffman, error) {
+	h := &huffman{vals: vals}
+	code, k := int32(0), int32(0)
+	for l := 1; l <= 16; l++ {
+		n := int32(counts[l-1])
+		h.minCode[l], h.valPtr[l], h.maxCode[l] = code, k, -1
+		if n == 0 {
+			code <<= 1
+			continue
+		}
+		if code+n > 1<<uint(l) {
+			return nil, errors.New("invalid huffman table")
+		}
+		for i := int32(0); i < n; i, code, k = i+1, code+1, k+1 {
+			if l > lutBits {
+				continue
+			}
+			shift := uint(lutBits - l)
+			for j := code << shift; j < (code+1)<<shift; j++ {
+				h.lut[j] = uint16(vals[k])<<8 | uint16(l)
+			}
+		}
+		h.maxCode[l] = code - 1
+		code <<= 1
+	}
+	return h, nil
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
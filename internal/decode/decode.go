@@ -0,0 +1,53 @@
+// Package decode turns captured frames into images.
+package decode
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+
+	// Frames are usually mjpeg, png is handy for testing.
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+// Func decodes a single frame.
+type Func func([]byte) (image.Image, error)
+
+// Modes that can be set on a source.
+const (
+	ModeFull = "full" // decode every pixel
+	ModeDC   = "dc"   // decode an eighth of the size, see DC
+)
+
+// Parse returns the decoder for a mode, an empty mode is ModeFull.
+func Parse(mode string) (Func, error) {
+	switch mode {
+	case "", ModeFull:
+		return Full, nil
+	case ModeDC:
+		return DC, nil
+	}
+	return nil, fmt.Errorf("unknown decode mode %q, expected %s or %s", mode, ModeFull, ModeDC)
+}
+
+// Full decodes a frame at its full size.
+func Full(b []byte) (image.Image, error) {
+	img, _, err := image.Decode(bytes.NewReader(b))
+	return img, err
+}
+
+// DC decodes a baseline jpeg at an eighth of its width and height.  Each
+// pixel is the average of an 8x8 block, which is just the block's DC
+// coefficient, so the rest of each block is skipped rather than
+// transformed.  That is all extraction needs and far cheaper than a full
+// decode.  Frames it can't handle, like progressive jpegs, get a full
+// decode instead.
+func DC(b []byte) (image.Image, error) {
+	img, err := decodeDC(b)
+	if errors.Is(err, errUnsupported) {
+		return Full(b)
+	}
+	return img, err
+}
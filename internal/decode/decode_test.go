@@ -0,0 +1,188 @@
+package decode
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"path"
+	"testing"
+
+	"github.com/Khabi/chromatic/internal/extract"
+	"github.com/stretchr/testify/assert"
+)
+
+// gradient is a smooth image, so every block is close to its average.
+func gradient(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 255 / w), G: uint8(y * 255 / h), B: 160, A: 255})
+		}
+	}
+	return img
+}
+
+// encode encodes img as a jpeg, without its huffman tables when dht is
+// false.
+func encode(tb testing.TB, img image.Image, dht bool) []byte {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+		tb.Fatal(err)
+	}
+	b := buf.Bytes()
+	if dht {
+		return b
+	}
+
+	// Go's encoder writes each segment once, before the scan.
+	for i := 2; i+4 < len(b) && b[i+1] != markerSOS; {
+		n := 2 + int(b[i+2])<<8 | int(b[i+3])
+		if b[i+1] == markerDHT {
+			b = append(b[:i], b[i+n:]...)
+			continue
+		}
+		i += n
+	}
+	return b
+}
+
+// read reads a file from testdata.
+func read(tb testing.TB, name string) []byte {
+	b, err := ioutil.ReadFile(path.Join("../../testdata", name))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return b
+}
+
+func TestParse(t *testing.T) {
+	for _, mode := range []string{"", ModeFull, ModeDC} {
+		_, err := Parse(mode)
+		assert.NoError(t, err, mode)
+	}
+	_, err := Parse("half")
+	assert.EqualError(t, err, `unknown decode mode "half", expected full or dc`)
+}
+
+func TestDC(t *testing.T) {
+	gray := image.NewGray(image.Rect(0, 0, 96, 64))
+	for i := range gray.Pix {
+		gray.Pix[i] = uint8(i % 96 * 2)
+	}
+
+	var tests = []struct {
+		name   string
+		frame  []byte
+		blocks bool // compare each block rather than the whole image
+	}{
+		{"avatar", read(t, "avatar.jpg"), false},
+		{"red", read(t, "red.jpg"), false},
+		{"gradient", encode(t, gradient(200, 120), true), true},
+		{"gray", encode(t, gray, true), true},
+	}
+
+	for _, td := range tests {
+		t.Run(td.name, func(t *testing.T) {
+			full, err := Full(td.frame)
+			assert.NoError(t, err)
+			dc, err := DC(td.frame)
+			assert.NoError(t, err)
+
+			b := full.Bounds()
+			assert.Equal(t, image.Rect(0, 0, (b.Dx()+7)/8, (b.Dy()+7)/8), dc.Bounds())
+
+			expected, actual := extract.Average(full), extract.Average(dc)
+			assert.InDelta(t, expected.R, actual.R, 0.01)
+			assert.InDelta(t, expected.G, actual.G, 0.01)
+			assert.InDelta(t, expected.B, actual.B, 0.01)
+
+			if !td.blocks {
+				return
+			}
+			for y := 0; y < dc.Bounds().Dy(); y++ {
+				for x := 0; x < dc.Bounds().Dx(); x++ {
+					expected := extract.AverageRect(full, image.Rect(x*8, y*8, x*8+8, y*8+8))
+					actual := extract.AverageRect(dc, image.Rect(x, y, x+1, y+1))
+					assert.InDelta(t, expected.R, actual.R, 0.04, "block %d,%d", x, y)
+					assert.InDelta(t, expected.G, actual.G, 0.04, "block %d,%d", x, y)
+					assert.InDelta(t, expected.B, actual.B, 0.04, "block %d,%d", x, y)
+				}
+			}
+		})
+	}
+}
+
+func TestDCStandardTables(t *testing.T) {
+	img := gradient(64, 48)
+	expected, err := DC(encode(t, img, true))
+	assert.NoError(t, err)
+
+	// Go's encoder uses the standard tables.
+	actual, err := DC(encode(t, img, false))
+	assert.NoError(t, err)
+	assert.Equal(t, expected, actual)
+}
+
+func TestDCRestart(t *testing.T) {
+	dqt := append([]byte{0xff, markerDQT, 0, 67, 0x00, 8}, bytes.Repeat([]byte{1}, 63)...)
+	frame := append([]byte{0xff, markerSOI}, dqt...)
+	frame = append(frame,
+		0xff, markerSOF0, 0, 11, 8, 0, 8, 0, 16, 1, 1, 0x11, 0,
+		0xff, markerDRI, 0, 4, 0, 1,
+		0xff, markerSOS, 0, 8, 1, 1, 0x00, 0, 63, 0,
+		// A DC difference of 16 and the end of block, twice.  The
+		// second is only 16 again if the restart resets it.
+		0xd0, 0xaf, 0xff, markerRST0,
+		0xd0, 0xaf,
+		0xff, markerEOI,
+	)
+
+	img, err := DC(frame)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{144, 144}, img.(*image.Gray).Pix)
+}
+
+func TestDCFallback(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, gradient(64, 48)))
+	img, err := DC(buf.Bytes())
+	assert.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 64, 48), img.Bounds())
+
+	frame := encode(t, gradient(64, 48), true)
+	_, err = DC(frame[:len(frame)/2])
+	assert.Error(t, err)
+}
+
+func BenchmarkDecode(b *testing.B) {
+	frames := []struct {
+		name  string
+		frame []byte
+	}{
+		{"avatar", read(b, "avatar.jpg")},
+		{"1080p", encode(b, gradient(1920, 1080), true)},
+	}
+	decoders := []struct {
+		name   string
+		decode Func
+	}{
+		{ModeFull, Full},
+		{ModeDC, DC},
+	}
+
+	for _, f := range frames {
+		for _, d := range decoders {
+			b.Run(f.name+"/"+d.name, func(b *testing.B) {
+				b.SetBytes(int64(len(f.frame)))
+				for i := 0; i < b.N; i++ {
+					if _, err := d.decode(f.frame); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package decode
+
+import (
+	"fmt"
+	"image"
+	"strings"
+
+	"github.com/korandiz/v4l/fmt/mjpeg"
+	"github.com/korandiz/v4l/fmt/yuyv"
+)
+
+// Pixel formats a source can capture in.
+const (
+	FormatMJPEG = "mjpeg"
+	FormatYUYV  = "yuyv" // packed 4:2:2
+	FormatNV12  = "nv12" // a luma plane then interleaved 4:2:0 chroma
+)
+
+const nv12FourCC = 'N' | 'V'<<8 | '1'<<16 | '2'<<24
+
+var fourCCs = map[string]uint32{
+	FormatMJPEG: mjpeg.FourCC,
+	FormatYUYV:  yuyv.FourCC,
+	FormatNV12:  nv12FourCC,
+}
+
+// FourCC returns the v4l code of a format, an empty format is
+// FormatMJPEG.
+func FourCC(format string) (uint32, error) {
+	if format == "" {
+		format = FormatMJPEG
+	}
+	code, ok := fourCCs[format]
+	if !ok {
+		return 0, fmt.Errorf("unknown format %q, expected %s, %s or %s", format, FormatMJPEG, FormatYUYV, FormatNV12)
+	}
+	return code, nil
+}
+
+// FormatName names a v4l code, formats chromatic can't capture in are
+// their four characters.
+func FormatName(code uint32) string {
+	for name, c := range fourCCs {
+		if c == code {
+			return name
+		}
+	}
+	b := []byte{byte(code), byte(code >> 8), byte(code >> 16), byte(code >> 24)}
+	return strings.ToLower(strings.TrimSpace(string(b)))
+}
+
+// Raw returns the decoder for uncompressed frames.  Frames are turned
+// straight into YCbCr images, which extraction reads without converting
+// each pixel.  stride is the number of bytes in each row of luma.
+func Raw(format string, width, height, stride int) (Func, error) {
+	if width < 1 || height < 1 {
+		return nil, fmt.Errorf("invalid frame size %dx%d", width, height)
+	}
+	switch format {
+	case FormatYUYV:
+		if width%2 != 0 {
+			return nil, fmt.Errorf("yuyv frames need an even width, not %d", width)
+		}
+		if stride < width*2 {
+			return nil, fmt.Errorf("stride %d is too small for %d yuyv pixels", stride, width)
+		}
+		return func(b []byte) (image.Image, error) {
+			return fromYUYV(b, width, height, stride)
+		}, nil
+	case FormatNV12:
+		if stride < width {
+			return nil, fmt.Errorf("stride %d is too small for %d nv12 pixels", stride, width)
+		}
+		return func(b []byte) (image.Image, error) {
+			return fromNV12(b, width, height, stride)
+		}, nil
+	}
+	return nil, fmt.Errorf("%q is not a raw format", format)
+}
+
+// fromYUYV splits the packed samples into planes.
+func fromYUYV(b []byte, width, height, stride int) (image.Image, error) {
+	if len(b) < stride*(height-1)+width*2 {
+		return nil, fmt.Errorf("yuyv frame is %d bytes, expected at least %d", len(b), stride*(height-1)+width*2)
+	}
+
+	img := image.NewYCbCr(image.Rect(0, 0, width, height), image.YCbCrSubsampleRatio422)
+	for y := 0; y < height; y++ {
+		row := b[y*stride : y*stride+width*2]
+		ys := img.Y[y*img.YStride:]
+		cb, cr := img.Cb[y*img.CStride:], img.Cr[y*img.CStride:]
+		for x := 0; x < width; x += 2 {
+			p := row[x*2 : x*2+4]
+			ys[x], cb[x/2], ys[x+1], cr[x/2] = p[0], p[1], p[2], p[3]
+		}
+	}
+	return img, nil
+}
+
+// fromNV12 uses the luma plane in place and splits the chroma.
+func fromNV12(b []byte, width, height, stride int) (image.Image, error) {
+	cw, ch := (width+1)/2, (height+1)/2
+	size := stride*height + stride*(ch-1) + cw*2
+	if len(b) < size {
+		return nil, fmt.Errorf("nv12 frame is %d bytes, expected at least %d", len(b), size)
+	}
+
+	img := &image.YCbCr{
+		Y:              b[:stride*height],
+		YStride:        stride,
+		Cb:             make([]byte, cw*ch),
+		Cr:             make([]byte, cw*ch),
+		CStride:        cw,
+		SubsampleRatio: image.YCbCrSubsampleRatio420,
+		Rect:           image.Rect(0, 0, width, height),
+	}
+	chroma := b[stride*height:]
+	for y := 0; y < ch; y++ {
+		row := chroma[y*stride : y*stride+cw*2]
+		for x := 0; x < cw; x++ {
+			img.Cb[y*cw+x], img.Cr[y*cw+x] = row[x*2], row[x*2+1]
+		}
+	}
+	return img, nil
+}
@@ -0,0 +1,83 @@
+package decode
+
+import (
+	"image"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// ycbcr is a gradient with the planes of a raw frame.
+func ycbcr(w, h int, ratio image.YCbCrSubsampleRatio) *image.YCbCr {
+	img := image.NewYCbCr(image.Rect(0, 0, w, h), ratio)
+	for i := range img.Y {
+		img.Y[i] = uint8(i)
+	}
+	for i := range img.Cb {
+		img.Cb[i], img.Cr[i] = uint8(i*3), uint8(255-i)
+	}
+	return img
+}
+
+func TestRaw(t *testing.T) {
+	const w, h, pad = 6, 4, 4
+
+	src := ycbcr(w, h, image.YCbCrSubsampleRatio422)
+	var frame []byte
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x += 2 {
+			c := src.COffset(x, y)
+			frame = append(frame, src.Y[src.YOffset(x, y)], src.Cb[c], src.Y[src.YOffset(x+1, y)], src.Cr[c])
+		}
+		frame = append(frame, make([]byte, pad)...)
+	}
+	dec, err := Raw(FormatYUYV, w, h, w*2+pad)
+	assert.NoError(t, err)
+	img, err := dec(frame)
+	assert.NoError(t, err)
+	assert.Equal(t, src, img)
+
+	src = ycbcr(w, h, image.YCbCrSubsampleRatio420)
+	frame = nil
+	for y := 0; y < h; y++ {
+		frame = append(frame, src.Y[y*w:y*w+w]...)
+		frame = append(frame, make([]byte, pad)...)
+	}
+	for y := 0; y < h/2; y++ {
+		for x := 0; x < w/2; x++ {
+			frame = append(frame, src.Cb[y*w/2+x], src.Cr[y*w/2+x])
+		}
+		frame = append(frame, make([]byte, pad)...)
+	}
+	dec, err = Raw(FormatNV12, w, h, w+pad)
+	assert.NoError(t, err)
+	img, err = dec(frame)
+	assert.NoError(t, err)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			assert.Equal(t, src.YCbCrAt(x, y), img.(*image.YCbCr).YCbCrAt(x, y), "pixel %d,%d", x, y)
+		}
+	}
+
+	_, err = dec(frame[:len(frame)-pad-1])
+	assert.EqualError(t, err, "nv12 frame is 55 bytes, expected at least 56")
+	_, err = Raw(FormatYUYV, 5, 4, 10)
+	assert.EqualError(t, err, "yuyv frames need an even width, not 5")
+	_, err = Raw(FormatMJPEG, 6, 4, 12)
+	assert.EqualError(t, err, `"mjpeg" is not a raw format`)
+}
+
+func TestFormats(t *testing.T) {
+	for _, format := range []string{FormatMJPEG, FormatYUYV, FormatNV12} {
+		code, err := FourCC(format)
+		assert.NoError(t, err)
+		assert.Equal(t, format, FormatName(code))
+	}
+	code, err := FourCC("")
+	assert.NoError(t, err)
+	assert.Equal(t, FormatMJPEG, FormatName(code))
+
+	_, err = FourCC("h264")
+	assert.EqualError(t, err, `unknown format "h264", expected mjpeg, yuyv or nv12`)
+	assert.Equal(t, "h264", FormatName('H'|'2'<<8|'6'<<16|'4'<<24))
+}
@@ -11,42 +11,117 @@ import (
 )
 
 // Average returns the average color of an image.
-// This is most effective in small images.  The bigger the
-// image, the more likely its going to move towards black
-// or brown.
 func Average(i image.Image) colorful.Color {
-	var r, g, b, a uint32     // RGBA values
-	var pr, pg, pb, pa uint32 // RGBA values at a specific point
+	return sumRect(i, i.Bounds(), nil).color()
+}
 
-	bounds := i.Bounds()
-	pixels := uint32(bounds.Dy() * bounds.Dx())
+// AverageRect returns the average color of the part of an image inside
+// r, without copying it out first.
+func AverageRect(i image.Image, r image.Rectangle) colorful.Color {
+	return sumRect(i, r, nil).color()
+}
 
-	for x := bounds.Min.X; x < bounds.Max.X; x++ {
-		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
-			pr, pg, pb, pa = i.At(x, y).RGBA()
-			r += pr
-			g += pg
-			b += pb
-			a += pa
-		}
+// AverageMasked returns the average color of the pixels in an image
+// that are not fully transparent in mask.  A nil mask averages
+// every pixel.
+func AverageMasked(i image.Image, mask *image.Alpha) colorful.Color {
+	if mask == nil {
+		return Average(i)
 	}
+	return sumRect(i, mask.Bounds(), mask).color()
+}
+
+// sum is a running total of 16 bit RGBA values.
+type sum struct {
+	r, g, b, a uint64
+	pixels     uint64
+}
 
-	r /= pixels
-	g /= pixels
-	b /= pixels
-	a /= pixels
+func (s *sum) add(r, g, b, a uint32) {
+	s.r += uint64(r)
+	s.g += uint64(g)
+	s.b += uint64(b)
+	s.a += uint64(a)
+	s.pixels++
+}
+
+// color is the average of every pixel added, black if there were none.
+func (s sum) color() colorful.Color {
+	if s.pixels == 0 {
+		return colorful.Color{}
+	}
 
 	avgColor, _ := colorful.MakeColor(
 		color.RGBA{
-			uint8(r / 0x101),
-			uint8(g / 0x101),
-			uint8(b / 0x101),
-			uint8(a / 0x101),
+			uint8(s.r / s.pixels / 0x101),
+			uint8(s.g / s.pixels / 0x101),
+			uint8(s.b / s.pixels / 0x101),
+			uint8(s.a / s.pixels / 0x101),
 		},
 	)
 	return avgColor
 }
 
+// sumRect adds up the pixels of i inside r, skipping pixels that are
+// fully transparent in mask when it is set.  *image.YCbCr, which is
+// what jpeg frames decode to, and *image.RGBA are read in place, other
+// images go through At which allocates for every pixel.
+func sumRect(i image.Image, r image.Rectangle, mask *image.Alpha) sum {
+	var s sum
+	r = r.Intersect(i.Bounds())
+
+	switch img := i.(type) {
+	case *image.YCbCr:
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				if mask != nil && mask.Pix[mask.PixOffset(x, y)] == 0 {
+					continue
+				}
+				yi, ci := img.YOffset(x, y), img.COffset(x, y)
+				s.add(color.YCbCr{Y: img.Y[yi], Cb: img.Cb[ci], Cr: img.Cr[ci]}.RGBA())
+			}
+		}
+	case *image.RGBA:
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				if mask != nil && mask.Pix[mask.PixOffset(x, y)] == 0 {
+					continue
+				}
+				p := img.Pix[img.PixOffset(x, y):]
+				s.add(uint32(p[0])*0x101, uint32(p[1])*0x101, uint32(p[2])*0x101, uint32(p[3])*0x101)
+			}
+		}
+	default:
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				if mask != nil && mask.Pix[mask.PixOffset(x, y)] == 0 {
+					continue
+				}
+				s.add(i.At(x, y).RGBA())
+			}
+		}
+	}
+	return s
+}
+
+// Mean blends colors together with equal weight.
+func Mean(colors ...colorful.Color) colorful.Color {
+	var m colorful.Color
+	if len(colors) == 0 {
+		return m
+	}
+	for _, c := range colors {
+		m.R += c.R
+		m.G += c.G
+		m.B += c.B
+	}
+	n := float64(len(colors))
+	m.R /= n
+	m.G /= n
+	m.B /= n
+	return m
+}
+
 // ByCount orders the cluster from most observations to last
 // cluster[0] will always be the most prominent.
 type ByCount []clusters.Cluster
@@ -2,6 +2,8 @@ package extract
 
 import (
 	"image"
+	"image/color"
+	"image/draw"
 	_ "image/jpeg"
 	"os"
 	"path"
@@ -12,6 +14,26 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
+// opaque hides the type of an image so only At can be used.
+type opaque struct {
+	image.Image
+}
+
+// load decodes an image from testdata.
+func load(tb testing.TB, name string) image.Image {
+	fh, err := os.Open(path.Join("../../testdata", name))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer fh.Close()
+
+	i, _, err := image.Decode(fh)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return i
+}
+
 func TestAverage(t *testing.T) {
 	var tests = []struct {
 		name     string
@@ -49,26 +71,27 @@ func TestAverage(t *testing.T) {
 			"average avatar",
 			"avatar.jpg",
 			colorful.Color{
-				R: 0.16861219195849547,
-				G: 0.023346303501945526,
-				B: 0.011673151750972763,
+				R: 0.47843137254901963,
+				G: 0.3333333333333333,
+				B: 0.3215686274509804,
 			},
 		},
 	}
 
 	for _, td := range tests {
 		t.Run(td.name, func(t *testing.T) {
-			fh, err := os.Open(path.Join("../../testdata", td.image))
-			assert.NoError(t, err)
-			defer fh.Close()
-
-			i, _, err := image.Decode(fh)
-			assert.NoError(t, err)
-
+			i := load(t, td.image)
 			c := Average(i)
 			t.Log("Hex Code: ", c.Hex())
 			assert.Equal(t, td.expected, c)
 
+			// The in place paths match going through At.
+			assert.IsType(t, &image.YCbCr{}, i)
+			assert.Equal(t, c, Average(opaque{i}))
+			rgba := image.NewRGBA(i.Bounds())
+			draw.Draw(rgba, rgba.Bounds(), i, image.Point{}, draw.Src)
+			assert.Equal(t, Average(rgba), Average(opaque{rgba}))
+
 		})
 
 	}
@@ -140,3 +163,122 @@ func TestProminent(t *testing.T) {
 
 	}
 }
+
+func TestAverageMasked(t *testing.T) {
+	i := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	i.Set(0, 0, color.RGBA{255, 0, 0, 255})
+	i.Set(1, 0, color.RGBA{0, 0, 255, 255})
+
+	mask := image.NewAlpha(i.Bounds())
+	mask.SetAlpha(1, 0, color.Alpha{0xff})
+
+	assert.Equal(t, colorful.Color{R: 0, G: 0, B: 1}, AverageMasked(i, mask))
+	assert.Equal(t, Average(i), AverageMasked(i, nil))
+}
+
+func TestMean(t *testing.T) {
+	c := Mean(colorful.Color{R: 1, G: 0, B: 0}, colorful.Color{R: 0, G: 0, B: 1})
+	assert.Equal(t, colorful.Color{R: 0.5, G: 0, B: 0.5}, c)
+	assert.Equal(t, colorful.Color{}, Mean())
+}
+
+func TestAverageRect(t *testing.T) {
+	i := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	draw.Draw(i, image.Rect(0, 0, 2, 2), image.NewUniform(color.RGBA{255, 0, 0, 255}), image.Point{}, draw.Src)
+	draw.Draw(i, image.Rect(2, 0, 4, 2), image.NewUniform(color.RGBA{0, 0, 255, 255}), image.Point{}, draw.Src)
+
+	assert.Equal(t, colorful.Color{R: 1, G: 0, B: 0}, AverageRect(i, image.Rect(0, 0, 2, 2)))
+	assert.Equal(t, colorful.Color{R: 0, G: 0, B: 1}, AverageRect(i, image.Rect(3, 1, 10, 10)))
+	assert.Equal(t, colorful.Color{}, AverageRect(i, image.Rect(5, 5, 10, 10)))
+}
+
+func TestIntegral(t *testing.T) {
+	i := load(t, "avatar.jpg")
+	table := NewIntegral(i)
+
+	rects := []image.Rectangle{
+		i.Bounds(),
+		image.Rect(0, 0, 1, 1),
+		image.Rect(10, 20, 200, 90),
+		image.Rect(400, 400, 500, 500),
+	}
+	// The table only keeps 8 bits, so it can be a step off.
+	near := func(want, got colorful.Color, r image.Rectangle) {
+		assert.InDelta(t, want.R, got.R, 1.5/255, "%v", r)
+		assert.InDelta(t, want.G, got.G, 1.5/255, "%v", r)
+		assert.InDelta(t, want.B, got.B, 1.5/255, "%v", r)
+	}
+	for _, r := range rects {
+		near(AverageRect(i, r), table.Average(r), r)
+	}
+	assert.Equal(t, colorful.Color{}, table.Average(image.Rect(500, 500, 600, 600)))
+
+	// Reset reuses the table for a smaller image.
+	red := load(t, "red.jpg")
+	table.Reset(red)
+	near(Average(red), table.Average(red.Bounds()), red.Bounds())
+}
+
+// edges are overlapping rectangles like 40 lights around the edge of a
+// square frame, each sampling a third of the way in.
+func edges(size int) []image.Rectangle {
+	var rects []image.Rectangle
+	step, width, depth := size/10, size/4, size/3
+	for n := 0; n < 10; n++ {
+		x := n * step
+		rects = append(rects,
+			image.Rect(x, 0, x+width, depth),
+			image.Rect(x, size-depth, x+width, size),
+			image.Rect(0, x, depth, x+width),
+			image.Rect(size-depth, x, size, x+width),
+		)
+	}
+	return rects
+}
+
+func BenchmarkAverage(b *testing.B) {
+	i := load(b, "avatar.jpg")
+	rgba := image.NewRGBA(i.Bounds())
+	draw.Draw(rgba, rgba.Bounds(), i, image.Point{}, draw.Src)
+
+	var benchmarks = []struct {
+		name  string
+		image image.Image
+	}{
+		{"ycbcr", i},
+		{"rgba", rgba},
+		{"at", opaque{i}},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for n := 0; n < b.N; n++ {
+				Average(bm.image)
+			}
+		})
+	}
+}
+
+func BenchmarkEdges(b *testing.B) {
+	i := load(b, "avatar.jpg")
+	rects := edges(i.Bounds().Dx())
+
+	b.Run("rect", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			for _, r := range rects {
+				AverageRect(i, r)
+			}
+		}
+	})
+	b.Run("integral", func(b *testing.B) {
+		b.ReportAllocs()
+		table := NewIntegral(i)
+		for n := 0; n < b.N; n++ {
+			table.Reset(i)
+			for _, r := range rects {
+				table.Average(r)
+			}
+		}
+	})
+}
@@ -0,0 +1,110 @@
+package extract
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+// Integral is a summed-area table of an image.  Once built it averages
+// any rectangle in constant time, which is cheaper than summing each one
+// when many bounds cover the same frame.  It keeps 8 bits per channel
+// and treats the image as opaque.
+type Integral struct {
+	rect   image.Rectangle
+	stride int
+	// sums holds the red, green and blue totals of every pixel above and
+	// to the left of each point, with a row and column of zeros first.
+	// They wrap around, but the difference between any four of them is
+	// exact while a rectangle has fewer than 16 million pixels.
+	sums []uint32
+}
+
+// NewIntegral builds the table for i.
+func NewIntegral(i image.Image) *Integral {
+	t := &Integral{}
+	t.Reset(i)
+	return t
+}
+
+// Reset rebuilds the table for i, reusing its memory when it can.
+func (t *Integral) Reset(i image.Image) {
+	t.rect = i.Bounds()
+	t.stride = (t.rect.Dx() + 1) * 3
+	size := t.stride * (t.rect.Dy() + 1)
+	if cap(t.sums) < size {
+		t.sums = make([]uint32, size)
+	}
+	t.sums = t.sums[:size]
+	for n := range t.sums[:t.stride] {
+		t.sums[n] = 0
+	}
+
+	pixels := make([]uint8, t.rect.Dx()*3)
+	for y := 0; y < t.rect.Dy(); y++ {
+		readRow(i, t.rect.Min.Y+y, pixels)
+		above := t.sums[y*t.stride:]
+		row := t.sums[(y+1)*t.stride:]
+		row[0], row[1], row[2] = 0, 0, 0
+
+		var r, g, b uint32 // totals of this row so far
+		for x := 0; x < t.rect.Dx(); x++ {
+			r += uint32(pixels[x*3])
+			g += uint32(pixels[x*3+1])
+			b += uint32(pixels[x*3+2])
+
+			n := (x + 1) * 3
+			row[n] = above[n] + r
+			row[n+1] = above[n+1] + g
+			row[n+2] = above[n+2] + b
+		}
+	}
+}
+
+// Average returns the average color of the part of the image inside r.
+func (t *Integral) Average(r image.Rectangle) colorful.Color {
+	r = r.Intersect(t.rect)
+	if r.Empty() {
+		return colorful.Color{}
+	}
+
+	x0, x1 := (r.Min.X-t.rect.Min.X)*3, (r.Max.X-t.rect.Min.X)*3
+	top := t.sums[(r.Min.Y-t.rect.Min.Y)*t.stride:]
+	bottom := t.sums[(r.Max.Y-t.rect.Min.Y)*t.stride:]
+	pixels := uint32(r.Dx() * r.Dy())
+
+	var avg [3]uint8
+	for c := range avg {
+		total := bottom[x1+c] - bottom[x0+c] - top[x1+c] + top[x0+c]
+		avg[c] = uint8(total / pixels)
+	}
+
+	avgColor, _ := colorful.MakeColor(color.RGBA{avg[0], avg[1], avg[2], 0xff})
+	return avgColor
+}
+
+// readRow reads the 8 bit colors of row y into pixels, reading
+// *image.YCbCr and *image.RGBA in place.
+func readRow(i image.Image, y int, pixels []uint8) {
+	b := i.Bounds()
+	switch img := i.(type) {
+	case *image.YCbCr:
+		for x := b.Min.X; x < b.Max.X; x++ {
+			yi, ci := img.YOffset(x, y), img.COffset(x, y)
+			n := (x - b.Min.X) * 3
+			pixels[n], pixels[n+1], pixels[n+2] = color.YCbCrToRGB(img.Y[yi], img.Cb[ci], img.Cr[ci])
+		}
+	case *image.RGBA:
+		p := img.Pix[img.PixOffset(b.Min.X, y):]
+		for x := 0; x < b.Dx(); x++ {
+			pixels[x*3], pixels[x*3+1], pixels[x*3+2] = p[x*4], p[x*4+1], p[x*4+2]
+		}
+	default:
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, _ := i.At(x, y).RGBA()
+			n := (x - b.Min.X) * 3
+			pixels[n], pixels[n+1], pixels[n+2] = uint8(r>>8), uint8(g>>8), uint8(bl>>8)
+		}
+	}
+}
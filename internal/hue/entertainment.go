@@ -0,0 +1,105 @@
+// Package hue drives philips hue lights.
+package hue
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/GetVivid/huego"
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+// StreamRate is how many colors a second entertainment streams show,
+// the bridge smooths between them and drops any more.
+const StreamRate = 25
+
+// Entertainment streams colors to the lights of an entertainment group.
+// It reconnects when the stream drops.
+type Entertainment struct {
+	*stream
+	v1Session
+}
+
+// v1Session is a single stream to an entertainment group.
+type v1Session struct {
+	group    *huego.EntertainmentGroup
+	url      string // the group in the api, including the username
+	username string
+	client   *http.Client
+	conn     *huego.EntertainmentStream
+}
+
+// NewEntertainment creates a sink for an entertainment group on bridge.
+func NewEntertainment(bridge *huego.Bridge, group *huego.EntertainmentGroup) *Entertainment {
+	host := bridge.Host
+	if !strings.Contains(host, "://") {
+		host = "http://" + host
+	}
+	e := &Entertainment{v1Session: v1Session{
+		group:    group,
+		url:      fmt.Sprintf("%s/api/%s/groups/%d", strings.TrimSuffix(host, "/"), bridge.User, group.ID),
+		username: bridge.User,
+		client:   &http.Client{Timeout: 2 * time.Second},
+	}}
+	e.stream = newStream(&e.v1Session, group.Name)
+	return e
+}
+
+func (e *v1Session) open() error {
+	conn, err := e.group.StartStream()
+	if err != nil {
+		return err
+	}
+	e.conn = conn
+	return nil
+}
+
+// send sends the colors keyed by light ID.
+func (e *v1Session) send(colors map[int]colorful.Color) error {
+	l := make(map[int][]float32)
+	for id, clr := range colors {
+		c1, c2, c3 := clr.Xyy()
+		l[id] = []float32{float32(c1), float32(c2), float32(c3)}
+	}
+	return e.conn.Set(l)
+}
+
+// check makes sure the bridge still has the group streaming to us.
+func (e *v1Session) check() error {
+	resp, err := e.client.Get(e.url)
+	if err != nil {
+		return fmt.Errorf("unable to check the stream: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var group struct {
+		Stream struct {
+			Active bool   `json:"active"`
+			Owner  string `json:"owner"`
+		} `json:"stream"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&group); err != nil {
+		return fmt.Errorf("unable to check the stream: %w", err)
+	}
+	if !group.Stream.Active {
+		return errors.New("bridge ended the stream")
+	}
+	if group.Stream.Owner != e.username {
+		return errStolen
+	}
+	return nil
+}
+
+// close stops the stream, the v1 api has no separate release.
+func (e *v1Session) close() {
+	e.conn.StopStream()
+	e.conn = nil
+}
+
+func (e *v1Session) release() error {
+	return nil
+}
@@ -0,0 +1,164 @@
+package hue
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/lucasb-eyer/go-colorful"
+	"github.com/pion/dtls/v2"
+)
+
+// HueStream v2 details, see the entertainment api docs on the hue
+// developer site.
+const (
+	StreamPort = 2100
+
+	streamMaxChannels = 20
+	streamHeaderSize  = 16 + 36 // protocol header and configuration id
+	streamChannelSize = 7
+	streamColorRGB    = 0x00
+)
+
+// EntertainmentV2 streams colors to the channels of an entertainment
+// configuration with the v2 api.  It reconnects when the stream drops.
+type EntertainmentV2 struct {
+	*stream
+	v2Session
+}
+
+// v2Session is a single dtls connection to the bridge.
+type v2Session struct {
+	client *Client
+	config EntertainmentConfiguration
+	key    []byte
+	port   int
+
+	identity string // application id, the bridge names the streamer by it
+	conn     net.Conn
+	seq      byte
+}
+
+// NewEntertainmentV2 creates a sink for an entertainment configuration,
+// clientKey is the hex key returned when registering.
+func NewEntertainmentV2(client *Client, config EntertainmentConfiguration, clientKey string) (*EntertainmentV2, error) {
+	key, err := hex.DecodeString(clientKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid client key: %w", err)
+	}
+	if len(config.ID) != 36 {
+		return nil, fmt.Errorf("invalid entertainment configuration id %q", config.ID)
+	}
+	e := &EntertainmentV2{v2Session: v2Session{client: client, config: config, key: key, port: StreamPort}}
+	e.stream = newStream(&e.v2Session, config.Name())
+	return e, nil
+}
+
+// open activates the configuration and opens the stream, taking it back
+// if another app has it.
+func (e *v2Session) open() error {
+	identity, err := e.client.ApplicationID()
+	if err != nil {
+		return err
+	}
+	addr, err := net.ResolveUDPAddr("udp", net.JoinHostPort(e.client.Host(), fmt.Sprint(e.port)))
+	if err != nil {
+		return err
+	}
+	if err := e.client.StartStream(e.config.ID); err != nil {
+		return err
+	}
+
+	conn, err := dtls.Dial("udp", addr, &dtls.Config{
+		PSK:             func([]byte) ([]byte, error) { return e.key, nil },
+		PSKIdentityHint: []byte(identity),
+		CipherSuites:    []dtls.CipherSuiteID{dtls.TLS_PSK_WITH_AES_128_GCM_SHA256},
+		ConnectContextMaker: func() (context.Context, func()) {
+			return context.WithTimeout(context.Background(), 5*time.Second)
+		},
+	})
+	if err != nil {
+		e.client.StopStream(e.config.ID)
+		return err
+	}
+	e.identity, e.conn = identity, conn
+	return nil
+}
+
+// send sends the colors keyed by channel ID.
+func (e *v2Session) send(colors map[int]colorful.Color) error {
+	e.seq++
+	_, err := e.conn.Write(streamMessage(e.config.ID, e.seq, colors))
+	return err
+}
+
+// check makes sure the bridge still has the configuration streaming
+// from us.
+func (e *v2Session) check() error {
+	var configs []struct {
+		Status   string     `json:"status"`
+		Streamer *Reference `json:"active_streamer"`
+	}
+	if err := e.client.do(http.MethodGet, "/clip/v2/resource/entertainment_configuration/"+e.config.ID, nil, &configs); err != nil {
+		return fmt.Errorf("unable to check the stream: %w", err)
+	}
+	if len(configs) == 0 {
+		return errors.New("entertainment configuration is gone")
+	}
+	if configs[0].Status != "active" {
+		return errors.New("bridge ended the stream")
+	}
+	if s := configs[0].Streamer; s != nil && s.RID != e.identity {
+		return errStolen
+	}
+	return nil
+}
+
+func (e *v2Session) close() {
+	e.conn.Close()
+	e.conn = nil
+}
+
+// release hands the lights back to the bridge.
+func (e *v2Session) release() error {
+	return e.client.StopStream(e.config.ID)
+}
+
+// streamMessage builds a HueStream v2 message with 16 bit rgb colors,
+// channels past the first 20 are dropped.
+func streamMessage(id string, seq byte, colors map[int]colorful.Color) []byte {
+	channels := make([]int, 0, len(colors))
+	for channel := range colors {
+		if channel >= 0 && channel <= 0xff {
+			channels = append(channels, channel)
+		}
+	}
+	sort.Ints(channels)
+	if len(channels) > streamMaxChannels {
+		channels = channels[:streamMaxChannels]
+	}
+
+	msg := make([]byte, streamHeaderSize, streamHeaderSize+len(channels)*streamChannelSize)
+	copy(msg, "HueStream")
+	msg[9], msg[10] = 2, 0 // version
+	msg[11] = seq
+	msg[14] = streamColorRGB
+	copy(msg[16:], id)
+
+	for _, channel := range channels {
+		c := colors[channel].Clamped()
+		var b [streamChannelSize]byte
+		b[0] = byte(channel)
+		binary.BigEndian.PutUint16(b[1:], uint16(c.R*0xffff+0.5))
+		binary.BigEndian.PutUint16(b[3:], uint16(c.G*0xffff+0.5))
+		binary.BigEndian.PutUint16(b[5:], uint16(c.B*0xffff+0.5))
+		msg = append(msg, b[:]...)
+	}
+	return msg
+}
@@ -0,0 +1,208 @@
+package hue
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lucasb-eyer/go-colorful"
+	"github.com/sirupsen/logrus"
+)
+
+// Hue asks for no more than about 10 light state changes a second.
+const (
+	MaxRate = 10
+
+	restMinChange = 0.02 // smallest CIE76 distance worth sending
+)
+
+// REST sets lights one at a time through the regular light state api.
+// It is much slower than an entertainment stream but works with any
+// light, so colors are sent at a limited rate and the lights that
+// changed the most are sent first.
+type REST struct {
+	url        string // base url of the api, including the username
+	rate       int
+	transition time.Duration
+	client     *http.Client
+
+	mu      sync.Mutex
+	pending map[int]colorful.Color // latest color for each light
+	sent    map[int]colorful.Color // color each light was last set to
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// NewREST creates a sink for the lights on a bridge.  rate is the
+// number of requests a second, up to MaxRate, and transition is how
+// long the lights fade to each new color.
+func NewREST(bridge, username string, rate int, transition time.Duration) (*REST, error) {
+	if rate < 1 || rate > MaxRate {
+		return nil, fmt.Errorf("rate %d is outside of 1 to %d", rate, MaxRate)
+	}
+	if transition < 0 {
+		return nil, fmt.Errorf("transition can't be negative")
+	}
+	if !strings.Contains(bridge, "://") {
+		bridge = "http://" + bridge
+	}
+
+	return &REST{
+		url:        strings.TrimSuffix(bridge, "/") + "/api/" + username,
+		rate:       rate,
+		transition: transition,
+		client:     &http.Client{Timeout: 2 * time.Second},
+	}, nil
+}
+
+// Start begins sending colors.
+func (r *REST) Start() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stop != nil {
+		return nil
+	}
+
+	r.pending = make(map[int]colorful.Color)
+	r.sent = make(map[int]colorful.Color)
+	r.stop = make(chan struct{})
+	r.done = make(chan struct{})
+	go r.run(r.stop, r.done)
+	return nil
+}
+
+// Set queues the colors keyed by light ID, only the latest color for
+// each light is sent.
+func (r *REST) Set(colors map[int]colorful.Color) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stop == nil {
+		return fmt.Errorf("sink is not started")
+	}
+
+	for id, clr := range colors {
+		r.pending[id] = clr
+	}
+	return nil
+}
+
+// Stop stops sending colors, the lights stay at their last color.
+func (r *REST) Stop() error {
+	r.mu.Lock()
+	stop, done := r.stop, r.done
+	r.stop = nil
+	r.mu.Unlock()
+
+	if stop == nil {
+		return nil
+	}
+	close(stop)
+	<-done
+	return nil
+}
+
+// run sends a light at every tick until stop is closed.
+func (r *REST) run(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(time.Second / time.Duration(r.rate))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			id, clr, ok := r.next()
+			if !ok {
+				continue
+			}
+			if err := r.update(id, clr); err != nil {
+				logrus.WithError(err).WithField("light", id).Error("unable to set light")
+				continue
+			}
+			r.mu.Lock()
+			r.sent[id] = clr
+			r.mu.Unlock()
+		}
+	}
+}
+
+// next picks the light whose color changed the most since it was last
+// sent, lights that were never sent come first.
+func (r *REST) next() (int, colorful.Color, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	best, bestID, found := restMinChange, 0, false
+	for id, clr := range r.pending {
+		change := math.Inf(1)
+		if sent, ok := r.sent[id]; ok {
+			change = clr.DistanceCIE76(sent)
+		}
+		// Ties go to the lowest ID so the order is stable.
+		if change > best || (change == best && found && id < bestID) {
+			best, bestID, found = change, id, true
+		}
+	}
+	return bestID, r.pending[bestID], found
+}
+
+// lightState is the body of a light state request.
+type lightState struct {
+	On             bool      `json:"on"`
+	XY             []float64 `json:"xy,omitempty"`
+	Bri            int       `json:"bri,omitempty"`
+	TransitionTime *int      `json:"transitiontime,omitempty"`
+}
+
+// update sets a single light to clr.
+func (r *REST) update(id int, clr colorful.Color) error {
+	x, y, Y := clr.Clamped().Xyy()
+	transition := int(r.transition / (100 * time.Millisecond))
+
+	state := lightState{TransitionTime: &transition}
+	if bri := int(math.Round(Y * 254)); bri > 0 {
+		state.On, state.XY, state.Bri = true, []float64{x, y}, bri
+	}
+
+	body, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPut, fmt.Sprintf("%s/lights/%d/state", r.url, id), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("bridge returned %s", resp.Status)
+	}
+
+	// The bridge reports errors in the body with a 200 status.
+	var results []struct {
+		Error *struct {
+			Type        int    `json:"type"`
+			Description string `json:"description"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		return err
+	}
+	for _, result := range results {
+		if result.Error != nil {
+			return fmt.Errorf("bridge error %d: %s", result.Error.Type, result.Error.Description)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package hue
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lucasb-eyer/go-colorful"
+	"github.com/stretchr/testify/assert"
+)
+
+type request struct {
+	path  string
+	state map[string]interface{}
+}
+
+// fakeBridge records light state requests, replying with reply.
+func fakeBridge(t *testing.T, reply string) (*httptest.Server, <-chan request) {
+	requests := make(chan request, 100)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var state map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&state); err != nil || r.Method != http.MethodPut {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		requests <- request{r.URL.Path, state}
+		w.Write([]byte(reply))
+	}))
+	t.Cleanup(server.Close)
+	return server, requests
+}
+
+func TestNewREST(t *testing.T) {
+	var tests = []struct {
+		name       string
+		rate       int
+		transition time.Duration
+		url        string
+		err        string
+	}{
+		{"valid", 10, 0, "http://bridge/api/user", ""},
+		{"rate too low", 0, 0, "", "rate 0 is outside of 1 to 10"},
+		{"rate too high", 11, 0, "", "rate 11 is outside of 1 to 10"},
+		{"negative transition", 5, -time.Second, "", "transition can't be negative"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, err := NewREST("bridge", "user", test.rate, test.transition)
+			if test.err != "" {
+				assert.EqualError(t, err, test.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.url, r.url)
+		})
+	}
+}
+
+func TestRESTNext(t *testing.T) {
+	r, _ := NewREST("bridge", "user", 10, 0)
+	assert.NoError(t, r.Start())
+	defer r.Stop()
+
+	red := colorful.Color{R: 1}
+	green := colorful.Color{G: 1}
+	r.mu.Lock()
+	r.sent = map[int]colorful.Color{1: red, 2: red, 3: red}
+	r.mu.Unlock()
+
+	// Nothing changed enough to send.
+	r.Set(map[int]colorful.Color{1: red, 2: {R: 0.999}})
+	_, _, ok := r.next()
+	assert.False(t, ok)
+
+	// The biggest change goes first.
+	r.Set(map[int]colorful.Color{2: {R: 0.8}, 3: green})
+	id, clr, ok := r.next()
+	assert.True(t, ok)
+	assert.Equal(t, 3, id)
+	assert.Equal(t, green, clr)
+
+	// Lights that were never sent beat any change.
+	r.Set(map[int]colorful.Color{5: red, 4: red})
+	id, _, _ = r.next()
+	assert.Equal(t, 4, id)
+}
+
+func TestREST(t *testing.T) {
+	server, requests := fakeBridge(t, `[{"success":{}}]`)
+
+	r, err := NewREST(server.URL, "user", 10, 300*time.Millisecond)
+	assert.NoError(t, err)
+	assert.Error(t, r.Set(map[int]colorful.Color{1: {}}), "not started")
+	assert.NoError(t, r.Start())
+	defer r.Stop()
+
+	assert.NoError(t, r.Set(map[int]colorful.Color{
+		3: {R: 1, G: 1, B: 1},
+		4: {},
+	}))
+
+	var got []request
+	for len(got) < 2 {
+		select {
+		case req := <-requests:
+			got = append(got, req)
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for requests")
+		}
+	}
+
+	assert.Equal(t, "/api/user/lights/3/state", got[0].path)
+	assert.Equal(t, true, got[0].state["on"])
+	assert.Equal(t, float64(254), got[0].state["bri"])
+	xy := got[0].state["xy"].([]interface{})
+	assert.InDelta(t, 0.3127, xy[0], 0.001)
+	assert.InDelta(t, 0.3290, xy[1], 0.001)
+	assert.Equal(t, float64(3), got[0].state["transitiontime"])
+
+	// Black turns the light off.
+	assert.Equal(t, "/api/user/lights/4/state", got[1].path)
+	assert.Equal(t, map[string]interface{}{"on": false, "transitiontime": float64(3)}, got[1].state)
+
+	// Nothing is sent again until a color changes.
+	select {
+	case req := <-requests:
+		t.Fatalf("unexpected request %v", req.path)
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	assert.NoError(t, r.Stop())
+	assert.NoError(t, r.Stop())
+}
+
+func TestRESTError(t *testing.T) {
+	server, _ := fakeBridge(t, `[{"error":{"type":201,"address":"/lights/1/state/bri","description":"parameter, bri, is not modifiable. Device is set to off."}}]`)
+
+	r, _ := NewREST(server.URL, "user", 10, 0)
+	err := r.update(1, colorful.Color{R: 1})
+	assert.EqualError(t, err, "bridge error 201: parameter, bri, is not modifiable. Device is set to off.")
+}
@@ -0,0 +1,225 @@
+package hue
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Khabi/chromatic/internal/sink"
+	"github.com/lucasb-eyer/go-colorful"
+	"github.com/sirupsen/logrus"
+)
+
+// errStolen is reported when another app starts streaming to the lights,
+// the stream is started again to take them back.
+var errStolen = errors.New("another app took over the stream")
+
+// session is a single connection to an entertainment stream.
+type session interface {
+	open() error
+	send(colors map[int]colorful.Color) error
+	// check asks the bridge whether the stream is still ours.
+	check() error
+	// close drops the connection, release also hands the lights back.
+	close()
+	release() error
+}
+
+// stream keeps a session open.  Sending over udp rarely fails when the
+// bridge goes away, so the bridge is also asked about the stream every
+// so often.  A broken session is reconnected from Set, backing off while
+// it keeps failing.
+//
+// Opening and closing a session can take seconds while the bridge is
+// down, so calls into the session are serialised by io and mu only
+// guards the state, keeping Health quick.
+type stream struct {
+	session session
+	log     *logrus.Entry
+
+	checkEvery time.Duration
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	io sync.Mutex // held while calling the session, before mu
+
+	mu      sync.Mutex
+	started bool
+	open    bool
+	opened  int // counts opens, so a check of an old session is ignored
+	health  sink.Health
+	backoff time.Duration
+	retry   time.Time // when to next try to reconnect
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+func newStream(s session, name string) *stream {
+	return &stream{
+		session:    s,
+		log:        logrus.WithField("stream", name),
+		checkEvery: 5 * time.Second,
+		minBackoff: time.Second,
+		maxBackoff: 30 * time.Second,
+	}
+}
+
+// Start opens the stream and starts watching it.
+func (s *stream) Start() error {
+	s.io.Lock()
+	defer s.io.Unlock()
+	if s.started {
+		return nil
+	}
+
+	if err := s.session.open(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.started, s.open = true, true
+	s.opened++
+	s.health = sink.Health{Connected: true}
+	s.backoff = 0
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go s.watch(s.stop, s.done)
+	return nil
+}
+
+// Set sends colors, reconnecting first if the session broke.
+func (s *stream) Set(colors map[int]colorful.Color) error {
+	s.io.Lock()
+	defer s.io.Unlock()
+	if !s.started {
+		return errors.New("sink is not started")
+	}
+
+	if !s.open {
+		s.mu.Lock()
+		retry, reason := s.retry, s.health.Reason
+		s.mu.Unlock()
+		if time.Now().Before(retry) {
+			return errors.New(reason)
+		}
+		if err := s.session.open(); err != nil {
+			s.fail(err)
+			return err
+		}
+		s.mu.Lock()
+		s.open = true
+		s.opened++
+		s.health.Connected = true
+		s.health.Reconnects++
+		s.backoff = 0
+		s.mu.Unlock()
+		s.log.Info("stream reconnected")
+	}
+
+	if err := s.session.send(colors); err != nil {
+		s.fail(err)
+		return err
+	}
+	return nil
+}
+
+// Stop stops watching the stream and hands the lights back.
+func (s *stream) Stop() error {
+	s.io.Lock()
+	if !s.started {
+		s.io.Unlock()
+		return nil
+	}
+	s.mu.Lock()
+	s.started = false
+	s.mu.Unlock()
+	close(s.stop)
+	done := s.done
+	s.io.Unlock()
+	<-done // watch may be waiting on io to fail a check
+
+	s.io.Lock()
+	defer s.io.Unlock()
+	if s.open {
+		s.session.close()
+	}
+	s.mu.Lock()
+	s.open = false
+	s.health.Connected = false
+	s.mu.Unlock()
+	return s.session.release()
+}
+
+// Health reports whether the stream is connected, and why it last
+// wasn't.
+func (s *stream) Health() sink.Health {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.health
+}
+
+// fail closes a broken session and schedules the next reconnect, it is
+// called with io held.
+func (s *stream) fail(err error) {
+	if s.open {
+		s.session.close()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.open = false
+	if s.health.Connected || s.health.Reason != err.Error() {
+		s.log.WithError(err).Warn("stream disconnected, reconnecting")
+	}
+	s.health.Connected = false
+	s.health.Reason = err.Error()
+
+	s.backoff *= 2
+	if s.backoff < s.minBackoff {
+		s.backoff = s.minBackoff
+	}
+	if s.backoff > s.maxBackoff {
+		s.backoff = s.maxBackoff
+	}
+	s.retry = time.Now().Add(s.backoff)
+}
+
+// watch checks the stream with the bridge until stop is closed.
+func (s *stream) watch(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(s.checkEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		s.mu.Lock()
+		open, opened := s.open, s.opened
+		s.mu.Unlock()
+		if !open {
+			continue
+		}
+
+		if err := s.session.check(); err != nil {
+			s.failCheck(opened, err)
+		}
+	}
+}
+
+// failCheck fails the session a check was made of, unless it has been
+// reopened or the stream stopped since.
+func (s *stream) failCheck(opened int, err error) {
+	s.io.Lock()
+	defer s.io.Unlock()
+
+	s.mu.Lock()
+	current := s.open && s.started && s.opened == opened
+	s.mu.Unlock()
+	if current {
+		s.fail(err)
+	}
+}
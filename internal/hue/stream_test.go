@@ -0,0 +1,155 @@
+package hue
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Khabi/chromatic/internal/sink"
+	"github.com/lucasb-eyer/go-colorful"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSession fails however the test tells it to.
+type fakeSession struct {
+	mu       sync.Mutex
+	opens    int
+	sendErr  error
+	checkErr error
+	released bool
+	opening  chan struct{} // when set, open waits for it to close
+	waiting  bool
+}
+
+func (f *fakeSession) open() error {
+	f.mu.Lock()
+	opening := f.opening
+	f.waiting = opening != nil
+	f.mu.Unlock()
+	if opening != nil {
+		<-opening
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.opens++
+	f.checkErr = nil // starting the stream takes it back
+	return nil
+}
+
+func (f *fakeSession) send(map[int]colorful.Color) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.sendErr
+}
+
+func (f *fakeSession) check() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.checkErr
+}
+
+func (f *fakeSession) close() {}
+
+func (f *fakeSession) release() error {
+	f.released = true
+	return nil
+}
+
+func (f *fakeSession) set(send, check error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sendErr, f.checkErr = send, check
+}
+
+func fakeStream() (*stream, *fakeSession) {
+	f := &fakeSession{}
+	s := newStream(f, "test")
+	s.checkEvery = 10 * time.Millisecond
+	s.minBackoff = 50 * time.Millisecond
+	return s, f
+}
+
+func TestStreamReconnect(t *testing.T) {
+	s, f := fakeStream()
+	colors := map[int]colorful.Color{1: {}}
+
+	assert.EqualError(t, s.Set(colors), "sink is not started")
+	assert.NoError(t, s.Start())
+	assert.NoError(t, s.Set(colors))
+	assert.Equal(t, sink.Health{Connected: true}, s.Health())
+
+	// The first failure closes the session, the next sets wait out the
+	// backoff rather than hammering the bridge.
+	f.set(errors.New("connection refused"), nil)
+	assert.EqualError(t, s.Set(colors), "connection refused")
+	f.set(nil, nil)
+	assert.EqualError(t, s.Set(colors), "connection refused")
+	assert.Equal(t, sink.Health{Reason: "connection refused"}, s.Health())
+
+	time.Sleep(s.minBackoff)
+	assert.NoError(t, s.Set(colors))
+	assert.Equal(t, sink.Health{Connected: true, Reason: "connection refused", Reconnects: 1}, s.Health())
+	assert.Equal(t, 2, f.opens)
+
+	assert.NoError(t, s.Stop())
+	assert.True(t, f.released)
+	assert.False(t, s.Health().Connected)
+	assert.NoError(t, s.Stop())
+}
+
+func TestStreamStolen(t *testing.T) {
+	s, f := fakeStream()
+	assert.NoError(t, s.Start())
+	defer s.Stop()
+
+	f.set(nil, errStolen)
+	assert.Eventually(t, func() bool {
+		return !s.Health().Connected
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, errStolen.Error(), s.Health().Reason)
+
+	// Set takes the lights back once the backoff is over.
+	assert.Eventually(t, func() bool {
+		return s.Set(map[int]colorful.Color{1: {}}) == nil
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 1, s.Health().Reconnects)
+}
+
+func TestStreamSlowReconnect(t *testing.T) {
+	s, f := fakeStream()
+	assert.NoError(t, s.Start())
+	defer s.Stop()
+
+	f.set(errors.New("connection refused"), nil)
+	assert.Error(t, s.Set(map[int]colorful.Color{1: {}}))
+	f.set(nil, nil)
+	opening := make(chan struct{})
+	f.mu.Lock()
+	f.opening = opening
+	f.mu.Unlock()
+
+	time.Sleep(s.minBackoff)
+	set := make(chan error)
+	go func() { set <- s.Set(map[int]colorful.Color{1: {}}) }()
+	assert.Eventually(t, func() bool {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		return f.waiting
+	}, time.Second, time.Millisecond)
+
+	// Health doesn't wait for the bridge while it reconnects.
+	health := make(chan sink.Health)
+	go func() { health <- s.Health() }()
+	select {
+	case h := <-health:
+		assert.False(t, h.Connected)
+	case <-time.After(time.Second):
+		t.Fatal("health blocked on the reconnect")
+	}
+
+	close(opening)
+	assert.NoError(t, <-set)
+	assert.True(t, s.Health().Connected)
+}
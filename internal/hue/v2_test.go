@@ -0,0 +1,198 @@
+package hue
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lucasb-eyer/go-colorful"
+	"github.com/pion/dtls/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+const configID = "1a8d99cc-967b-44f2-9202-43f976c0fa6b"
+
+const configurations = `{"errors": [], "data": [{
+	"id": "` + configID + `",
+	"type": "entertainment_configuration",
+	"metadata": {"name": "TV area"},
+	"configuration_type": "screen",
+	"status": "inactive",
+	"channels": [
+		{"channel_id": 0, "position": {"x": -0.5, "y": 0.8, "z": 0}, "members": [{"service": {"rid": "ent-1", "rtype": "entertainment"}, "index": 0}]},
+		{"channel_id": 1, "position": {"x": 0.2, "y": -0.9, "z": 0}, "members": [{"service": {"rid": "ent-2", "rtype": "entertainment"}, "index": 3}]}
+	]
+}]}`
+
+// fakeV2Bridge answers the v2 endpoints chromatic uses and records
+// stream actions.
+func fakeV2Bridge(t *testing.T) (*Client, <-chan string) {
+	actions := make(chan string, 10)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("hue-application-key") != "user" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors": [{"description": "unauthorized user"}], "data": []}`))
+			return
+		}
+
+		switch {
+		case r.URL.Path == "/auth/v1":
+			w.Header().Set("hue-application-id", "app-id")
+		case r.URL.Path == "/clip/v2/resource/entertainment_configuration":
+			w.Write([]byte(configurations))
+		case r.URL.Path == "/clip/v2/resource/entertainment_configuration/"+configID && r.Method == http.MethodPut:
+			var body map[string]string
+			json.NewDecoder(r.Body).Decode(&body)
+			actions <- body["action"]
+			w.Write([]byte(`{"errors": [], "data": [{"rid": "` + configID + `", "rtype": "entertainment_configuration"}]}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors": [{"description": "resource not found"}], "data": []}`))
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := NewClient(server.URL, "user")
+	assert.NoError(t, err)
+	return client, actions
+}
+
+func TestEntertainmentConfigurations(t *testing.T) {
+	client, _ := fakeV2Bridge(t)
+
+	configs, err := client.EntertainmentConfigurations()
+	assert.NoError(t, err)
+	assert.Len(t, configs, 1)
+	assert.Equal(t, "TV area", configs[0].Name())
+	assert.Len(t, configs[0].Channels, 2)
+	assert.Equal(t, 1, configs[0].Channels[1].ID)
+	assert.Equal(t, 0.2, configs[0].Channels[1].Position.X)
+	assert.Equal(t, Member{Service: Reference{RID: "ent-2", RType: "entertainment"}, Index: 3}, configs[0].Channels[1].Members[0])
+
+	for _, name := range []string{"TV area", configID} {
+		config, err := client.EntertainmentConfiguration(name)
+		assert.NoError(t, err)
+		assert.Equal(t, configID, config.ID)
+	}
+
+	_, err = client.EntertainmentConfiguration("Office")
+	assert.EqualError(t, err, `no entertainment configuration named "Office"`)
+
+	_, err = client.Devices()
+	assert.EqualError(t, err, "resource not found")
+
+	client.key = "someone"
+	_, err = client.EntertainmentConfigurations()
+	assert.EqualError(t, err, "unauthorized user")
+}
+
+func TestStreamMessage(t *testing.T) {
+	msg := streamMessage(configID, 7, map[int]colorful.Color{
+		2: {R: 1, G: 0, B: 0.5},
+		0: {R: 0, G: 1, B: 0},
+	})
+
+	assert.Equal(t, []byte("HueStream\x02\x00\x07\x00\x00\x00\x00"), msg[:16])
+	assert.Equal(t, configID, string(msg[16:52]))
+	assert.Equal(t, []byte{
+		0, 0x00, 0x00, 0xff, 0xff, 0x00, 0x00,
+		2, 0xff, 0xff, 0x00, 0x00, 0x80, 0x00,
+	}, msg[52:])
+
+	many := make(map[int]colorful.Color)
+	for i := 0; i < 30; i++ {
+		many[i] = colorful.Color{}
+	}
+	assert.Len(t, streamMessage(configID, 0, many), streamHeaderSize+streamMaxChannels*streamChannelSize)
+}
+
+func TestEntertainmentV2(t *testing.T) {
+	client, actions := fakeV2Bridge(t)
+	config, err := client.EntertainmentConfiguration("TV area")
+	assert.NoError(t, err)
+
+	_, err = NewEntertainmentV2(client, *config, "not hex")
+	assert.Error(t, err)
+
+	listener, err := dtls.Listen("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}, &dtls.Config{
+		PSK: func(identity []byte) ([]byte, error) {
+			assert.Equal(t, "app-id", string(identity))
+			return []byte{0x01, 0x02, 0x03, 0x04}, nil
+		},
+		CipherSuites: []dtls.CipherSuiteID{dtls.TLS_PSK_WITH_AES_128_GCM_SHA256},
+	})
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		buf := make([]byte, 1024)
+		n, err := conn.Read(buf)
+		if err == nil {
+			received <- buf[:n]
+		}
+	}()
+
+	e, err := NewEntertainmentV2(client, *config, "01020304")
+	assert.NoError(t, err)
+	e.port = listener.Addr().(*net.UDPAddr).Port
+
+	assert.Error(t, e.Set(map[int]colorful.Color{0: {}}))
+	assert.NoError(t, e.Start())
+	assert.Equal(t, "start", <-actions)
+
+	assert.NoError(t, e.Set(map[int]colorful.Color{1: {R: 1, G: 1, B: 1}}))
+	select {
+	case msg := <-received:
+		assert.Equal(t, byte(1), msg[11])
+		assert.Equal(t, []byte{1, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, msg[52:])
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for stream")
+	}
+
+	assert.NoError(t, e.Stop())
+	assert.Equal(t, "stop", <-actions)
+	assert.NoError(t, e.Stop())
+}
+
+func TestEntertainmentV2Check(t *testing.T) {
+	var tests = []struct {
+		name     string
+		response string
+		err      string
+	}{
+		{"ours", `[{"status": "active", "active_streamer": {"rid": "app-id", "rtype": "auth_v1"}}]`, ""},
+		{"stolen", `[{"status": "active", "active_streamer": {"rid": "other-app", "rtype": "auth_v1"}}]`, errStolen.Error()},
+		{"ended", `[{"status": "inactive"}]`, "bridge ended the stream"},
+		{"gone", `[]`, "entertainment configuration is gone"},
+	}
+
+	for _, td := range tests {
+		t.Run(td.name, func(t *testing.T) {
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/clip/v2/resource/entertainment_configuration/"+configID, r.URL.Path)
+				w.Write([]byte(`{"errors": [], "data": ` + td.response + `}`))
+			}))
+			defer server.Close()
+
+			client, err := NewClient(server.URL, "user")
+			assert.NoError(t, err)
+			s := v2Session{client: client, config: EntertainmentConfiguration{ID: configID}, identity: "app-id"}
+
+			err = s.check()
+			if td.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, td.err)
+			}
+		})
+	}
+}
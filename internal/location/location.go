@@ -1,7 +1,10 @@
 package location
 
 import (
+	"fmt"
 	"image"
+	"math"
+	"strings"
 )
 
 // Preset options for sampling
@@ -11,12 +14,18 @@ const (
 	Left
 	Right
 	Whole
+	TopLeft
+	TopRight
+	BottomLeft
+	BottomRight
 )
 
 // Default length and widths for presets.
 const (
 	borderThickness = 5
 	borderLength    = 100
+	cornerSize      = 15
+	nearCenter      = 0.25
 )
 
 type Bounds []Bound
@@ -36,8 +45,18 @@ type Bound struct {
 	ID     int     // identifier for the location
 	X      float64 // x-axis centerpoint between -1 and 1
 	Y      float64 // y-axis centerpoint between -1 and 1
-	Width  int     // width in % of the rectangle around the centerpoint
-	Height int     // height in % of the rectangle around the centerpoint
+	Width  float64 // width in % of the rectangle around the centerpoint
+	Height float64 // height in % of the rectangle around the centerpoint
+
+	// Polygon optionally limits sampling to the pixels inside a shape,
+	// centerpoint and size are ignored when it is set.
+	Polygon []Point
+}
+
+// Point is a location on the -1 to 1 grid.
+type Point struct {
+	X float64
+	Y float64
 }
 
 // Preset is a helper to create some common bounds.
@@ -53,21 +72,124 @@ func Preset(id int, preset int) Bound {
 		return Bound{ID: id, X: 1, Y: 0, Width: borderThickness, Height: borderLength}
 	case Whole:
 		return Bound{ID: id, X: 0, Y: 0, Width: borderLength, Height: borderLength}
+	case TopLeft:
+		return Bound{ID: id, X: -1, Y: 1, Width: cornerSize, Height: cornerSize}
+	case TopRight:
+		return Bound{ID: id, X: 1, Y: 1, Width: cornerSize, Height: cornerSize}
+	case BottomLeft:
+		return Bound{ID: id, X: -1, Y: -1, Width: cornerSize, Height: cornerSize}
+	case BottomRight:
+		return Bound{ID: id, X: 1, Y: -1, Width: cornerSize, Height: cornerSize}
 
 	default:
 		return Bound{}
 	}
 }
 
+// presetNames are the names used to refer to presets in the config.
+var presetNames = map[int]string{
+	Top:    "top",
+	Bottom: "bottom",
+	Left:   "left",
+	Right:  "right",
+	Whole:  "whole",
+
+	TopLeft:     "top-left corner",
+	TopRight:    "top-right corner",
+	BottomLeft:  "bottom-left corner",
+	BottomRight: "bottom-right corner",
+}
+
+// PresetName returns the config name of a preset.
+func PresetName(preset int) string {
+	return presetNames[preset]
+}
+
+// ParsePreset returns the preset with the given config name.
+func ParsePreset(name string) (int, error) {
+	for preset, n := range presetNames {
+		if n == name {
+			return preset, nil
+		}
+	}
+	var names []string
+	for preset := Top; preset <= BottomRight; preset++ {
+		names = append(names, presetNames[preset])
+	}
+	return 0, fmt.Errorf("unknown preset %q, expected one of %s", name, strings.Join(names, ", "))
+}
+
+// Segment is a helper to sample along a line, like a strip light
+// running along part of an edge.  Depth is the thickness in % of the
+// screen, the line is kept on the grid.
+func Segment(id int, from Point, to Point, depth float64) Bound {
+	// Unit normal of the line, scaled to half the depth on the 2 wide grid.
+	dx, dy := to.X-from.X, to.Y-from.Y
+	length := math.Hypot(dx, dy)
+	if length == 0 {
+		return Bound{ID: id, X: from.X, Y: from.Y, Width: depth, Height: depth}
+	}
+	half := depth / 100
+	nx, ny := -dy/length*half, dx/length*half
+
+	return Bound{ID: id, Polygon: []Point{
+		clamp(Point{from.X + nx, from.Y + ny}),
+		clamp(Point{to.X + nx, to.Y + ny}),
+		clamp(Point{to.X - nx, to.Y - ny}),
+		clamp(Point{from.X - nx, from.Y - ny}),
+	}}
+}
+
+// clamp moves a point back on to the grid.
+func clamp(p Point) Point {
+	return Point{
+		X: math.Max(-1, math.Min(1, p.X)),
+		Y: math.Max(-1, math.Min(1, p.Y)),
+	}
+}
+
+// Nearest guesses the preset that best matches a centerpoint.
+// Points close to the middle of the screen sample the whole screen,
+// everything else samples the edge it leans towards the most.
+func Nearest(x float64, y float64) int {
+	switch {
+	case math.Abs(x) < nearCenter && math.Abs(y) < nearCenter:
+		return Whole
+	case math.Abs(x) >= math.Abs(y) && x < 0:
+		return Left
+	case math.Abs(x) >= math.Abs(y):
+		return Right
+	case y < 0:
+		return Bottom
+	default:
+		return Top
+	}
+}
+
 // Rectangle takes a bounding box and converts it to a rectangle.
 // If the bounding box center places any part of the box outside
 // the given width and height, the box is adjusted over to fix inside.
+// Polygons return the smallest rectangle holding every point.
 func (b Bound) Rectangle(width int, height int) image.Rectangle {
+	if len(b.Polygon) > 0 {
+		var r image.Rectangle
+		for i, p := range b.Polygon {
+			pt := toPixel(p.X, p.Y, width, height)
+			pr := image.Rectangle{pt, pt.Add(image.Point{1, 1})}
+			if i == 0 {
+				r = pr
+			} else {
+				r = r.Union(pr)
+			}
+		}
+		return r.Intersect(image.Rect(0, 0, width, height))
+	}
+
 	var tl image.Point // topleft of rectangle
 	var br image.Point // bottom right of rectangle
 
-	boxWidth := (width * b.Width) / 100
-	boxHeight := (height * b.Height) / 100
+	boxWidth := int(float64(width) * b.Width / 100)
+	boxHeight := int(float64(height) * b.Height / 100)
 
 	center := b.CenterPoint(width, height)
 
@@ -100,10 +222,75 @@ func (b Bound) Rectangle(width int, height int) image.Rectangle {
 	return image.Rectangle{tl, br}
 }
 
+// Mask returns which pixels of Rectangle are inside the polygon, or nil
+// when the bound samples the whole rectangle.
+func (b Bound) Mask(width int, height int) *image.Alpha {
+	if len(b.Polygon) == 0 {
+		return nil
+	}
+
+	r := b.Rectangle(width, height)
+	mask := image.NewAlpha(r)
+
+	poly := make([][2]float64, len(b.Polygon))
+	for i, p := range b.Polygon {
+		pt := toPixel(p.X, p.Y, width, height)
+		poly[i] = [2]float64{float64(pt.X), float64(pt.Y)}
+	}
+
+	// Even-odd test against each pixel's center.
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		py := float64(y) + 0.5
+		for x := r.Min.X; x < r.Max.X; x++ {
+			px := float64(x) + 0.5
+			inside := false
+			for i, j := 0, len(poly)-1; i < len(poly); j, i = i, i+1 {
+				a, c := poly[i], poly[j]
+				if (a[1] > py) != (c[1] > py) && px < (c[0]-a[0])*(py-a[1])/(c[1]-a[1])+a[0] {
+					inside = !inside
+				}
+			}
+			if inside {
+				mask.Pix[mask.PixOffset(x, y)] = 0xff
+			}
+		}
+	}
+	return mask
+}
+
+// Validate checks that the centerpoint falls on the grid and the
+// box is a usable size.
+func (b Bound) Validate() error {
+	if len(b.Polygon) > 0 {
+		if len(b.Polygon) < 3 {
+			return fmt.Errorf("polygon needs at least 3 points, has %d", len(b.Polygon))
+		}
+		for _, p := range b.Polygon {
+			if p.X < -1 || p.X > 1 || p.Y < -1 || p.Y > 1 {
+				return fmt.Errorf("polygon point %v,%v is outside of -1 to 1", p.X, p.Y)
+			}
+		}
+		return nil
+	}
+
+	if b.X < -1 || b.X > 1 || b.Y < -1 || b.Y > 1 {
+		return fmt.Errorf("centerpoint %v,%v is outside of -1 to 1", b.X, b.Y)
+	}
+	if b.Width <= 0 || b.Width > 100 || b.Height <= 0 || b.Height > 100 {
+		return fmt.Errorf("size %vx%v is outside of 0 to 100%%", b.Width, b.Height)
+	}
+	return nil
+}
+
 // CenterToPoint takes the center and converts it to a point location
 // in a box with the given width and height.
 func (b Bound) CenterPoint(width int, height int) image.Point {
-	x := int((b.X + 1) * (float64(width) / 2))
-	y := int(((-1 * b.Y) + 1) * (float64(height) / 2))
+	return toPixel(b.X, b.Y, width, height)
+}
+
+// toPixel converts a location on the grid to a pixel.
+func toPixel(gx float64, gy float64, width int, height int) image.Point {
+	x := int((gx + 1) * (float64(width) / 2))
+	y := int(((-1 * gy) + 1) * (float64(height) / 2))
 	return image.Point{x, y}
 }
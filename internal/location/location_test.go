@@ -9,34 +9,34 @@ import (
 
 func TestPreset(t *testing.T) {
 	var tests = []struct {
-		ID       string
+		ID       int
 		Preset   int
 		Expected Bound
 	}{
 		{
-			"Light 1",
+			1,
 			Top,
-			Bound{ID: "Light 1", X: 0, Y: 1, Width: borderLength, Height: borderThickness},
+			Bound{ID: 1, X: 0, Y: 1, Width: borderLength, Height: borderThickness},
 		},
 		{
-			"Light 2",
+			2,
 			Bottom,
-			Bound{ID: "Light 2", X: 0, Y: -1, Width: borderLength, Height: borderThickness},
+			Bound{ID: 2, X: 0, Y: -1, Width: borderLength, Height: borderThickness},
 		},
 		{
-			"Light 3",
+			3,
 			Left,
-			Bound{ID: "Light 3", X: -1, Y: 0, Width: borderThickness, Height: borderLength},
+			Bound{ID: 3, X: -1, Y: 0, Width: borderThickness, Height: borderLength},
 		},
 		{
-			"Light 4",
+			4,
 			Right,
-			Bound{ID: "Light 4", X: 1, Y: 0, Width: borderThickness, Height: borderLength},
+			Bound{ID: 4, X: 1, Y: 0, Width: borderThickness, Height: borderLength},
 		},
 		{
-			"Light 5",
+			5,
 			Whole,
-			Bound{ID: "Light 5", X: 0, Y: 0, Width: borderLength, Height: borderLength},
+			Bound{ID: 5, X: 0, Y: 0, Width: borderLength, Height: borderLength},
 		},
 	}
 
@@ -52,15 +52,15 @@ func TestCenterPoint(t *testing.T) {
 	var height = 768
 
 	var tests = []struct {
-		ID       string
+		ID       int
 		X        float64
 		Y        float64
 		Expected image.Point
 	}{
-		{"light 1", -1, 1, image.Point{0, 0}},
-		{"light 2", 0, 0, image.Point{512, 384}},
-		{"light 3", 1, -1, image.Point{1024, 768}},
-		{"light 4", .5, -.5, image.Point{768, 576}},
+		{1, -1, 1, image.Point{0, 0}},
+		{2, 0, 0, image.Point{512, 384}},
+		{3, 1, -1, image.Point{1024, 768}},
+		{4, .5, -.5, image.Point{768, 576}},
 	}
 
 	for _, td := range tests {
@@ -80,17 +80,17 @@ func TestRectangle(t *testing.T) {
 	}{
 		{
 			// Top left corner out of bounds
-			Bound{ID: "Light 1", X: -1, Y: 1, Width: 25, Height: 25},
+			Bound{ID: 1, X: -1, Y: 1, Width: 25, Height: 25},
 			image.Rect(0, 0, 256, 192),
 		},
 		{
 			// Bottom right corner out of bounds
-			Bound{ID: "Light 2", X: 1, Y: -1, Width: 25, Height: 25},
+			Bound{ID: 2, X: 1, Y: -1, Width: 25, Height: 25},
 			image.Rect(768, 576, 1024, 768),
 		},
 		{
 			// Centered in bounds
-			Bound{ID: "Light 3", X: 0, Y: 0, Width: 25, Height: 25},
+			Bound{ID: 3, X: 0, Y: 0, Width: 25, Height: 25},
 			image.Rect(384, 288, 640, 480),
 		},
 	}
@@ -100,3 +100,58 @@ func TestRectangle(t *testing.T) {
 		assert.Equal(t, td.Expected, b)
 	}
 }
+
+func TestNearest(t *testing.T) {
+	var tests = []struct {
+		X        float64
+		Y        float64
+		Expected int
+	}{
+		{0, 0, Whole},
+		{0.1, -0.2, Whole},
+		{-1, 0, Left},
+		{-0.8, 0.5, Left},
+		{1, 1, Right},
+		{0.4, -0.2, Right},
+		{0, -1, Bottom},
+		{0.3, -0.9, Bottom},
+		{0, 1, Top},
+		{-0.5, 0.6, Top},
+	}
+
+	for _, td := range tests {
+		assert.Equal(t, td.Expected, Nearest(td.X, td.Y), "%v,%v", td.X, td.Y)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, Preset(1, Top).Validate())
+	assert.NoError(t, Bound{ID: 1, X: -1, Y: 1, Width: 5, Height: 5}.Validate())
+	assert.Error(t, Bound{ID: 1, X: 1.5, Y: 0, Width: 5, Height: 5}.Validate())
+	assert.Error(t, Bound{ID: 1, X: 0, Y: 0, Width: 0, Height: 5}.Validate())
+	assert.Error(t, Bound{ID: 1, X: 0, Y: 0, Width: 5, Height: 101}.Validate())
+}
+
+func TestPolygon(t *testing.T) {
+	var width = 100
+	var height = 100
+
+	// Triangle covering the top left half of the top left quarter.
+	b := Bound{ID: 1, Polygon: []Point{{-1, 1}, {0, 1}, {-1, 0}}}
+	assert.Equal(t, image.Rect(0, 0, 51, 51), b.Rectangle(width, height))
+
+	mask := b.Mask(width, height)
+	assert.Equal(t, uint8(0xff), mask.AlphaAt(1, 1).A)
+	assert.Equal(t, uint8(0xff), mask.AlphaAt(10, 30).A)
+	assert.Equal(t, uint8(0), mask.AlphaAt(40, 40).A)
+	assert.Equal(t, uint8(0), mask.AlphaAt(49, 49).A)
+
+	assert.Nil(t, Preset(1, Top).Mask(width, height))
+}
+
+func TestSegment(t *testing.T) {
+	b := Segment(1, Point{-1, -1}, Point{0, -1}, 10)
+	assert.Equal(t, []Point{{-1, -0.9}, {0, -0.9}, {0, -1}, {-1, -1}}, b.Polygon)
+	assert.NoError(t, b.Validate())
+	assert.Equal(t, image.Rect(0, 95, 51, 100), b.Rectangle(100, 100))
+}
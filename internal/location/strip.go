@@ -0,0 +1,181 @@
+package location
+
+import (
+	"fmt"
+)
+
+// Directions a strip can run around the screen.
+const (
+	Clockwise = iota
+	CounterClockwise
+)
+
+// Strip splits an edge, or the whole perimeter of the screen, into evenly
+// spaced segments.  This is used for strip lights that have many zones.
+type Strip struct {
+	Edge      int     // Top, Bottom, Left, Right, or Whole for the perimeter
+	Count     int     // number of segments
+	Depth     float64 // how far each segment reaches into the screen in %
+	Start     int     // corner the first segment is at, TopLeft etc
+	Direction int     // Clockwise or CounterClockwise, only used by Whole
+	Gap       float64 // space between segments in % of the edge
+
+	// IDs are the sink channels for each segment in order, when empty
+	// the segments are numbered up from FirstID.
+	IDs     []int
+	FirstID int
+}
+
+// corners of the grid, clockwise from the top left.
+var corners = []struct {
+	preset int
+	point  Point
+}{
+	{TopLeft, Point{-1, 1}},
+	{TopRight, Point{1, 1}},
+	{BottomRight, Point{1, -1}},
+	{BottomLeft, Point{-1, -1}},
+}
+
+// edge is a side of the screen walked from one corner to another.
+type edge struct {
+	from Point
+	to   Point
+}
+
+// horizontal is true for the top and bottom edges.
+func (e edge) horizontal() bool {
+	return e.from.Y == e.to.Y
+}
+
+// Bounds returns a bound for every segment of the strip.  Segments that
+// wrap around a corner are made of two bounds with the same ID, which
+// get averaged together.
+func (s Strip) Bounds() (Bounds, error) {
+	edges, err := s.edges()
+	if err != nil {
+		return nil, err
+	}
+	if s.Count <= 0 {
+		return nil, fmt.Errorf("count must be above 0")
+	}
+	if len(s.IDs) > 0 && len(s.IDs) != s.Count {
+		return nil, fmt.Errorf("has %d ids for %d segments", len(s.IDs), s.Count)
+	}
+	if s.Depth <= 0 || s.Depth > 100 {
+		return nil, fmt.Errorf("depth %v is outside of 0 to 100%%", s.Depth)
+	}
+	if s.Gap < 0 {
+		return nil, fmt.Errorf("gap can't be negative")
+	}
+
+	// Work in grid units along the strip, every edge is 2 long.
+	length := 2 * float64(len(edges))
+	gap := s.Gap / 50
+	gaps := float64(s.Count - 1)
+	if s.Edge == Whole {
+		gaps++ // the gap between the last and first segment
+	}
+	size := (length - gap*gaps) / float64(s.Count)
+	if size <= 0 {
+		return nil, fmt.Errorf("gap of %v leaves no room for %d segments", s.Gap, s.Count)
+	}
+
+	var bounds Bounds
+	for i := 0; i < s.Count; i++ {
+		id := s.FirstID + i
+		if len(s.IDs) > 0 {
+			id = s.IDs[i]
+		}
+
+		start := float64(i) * (size + gap)
+		end := start + size
+		for n, e := range edges {
+			// Part of the segment on this edge, in grid units from e.from.
+			s0 := start - 2*float64(n)
+			s1 := end - 2*float64(n)
+			if s0 < 0 {
+				s0 = 0
+			}
+			if s1 > 2 {
+				s1 = 2
+			}
+			if s1 <= s0 {
+				continue
+			}
+
+			mid := (s0 + s1) / 4
+			b := Bound{
+				ID: id,
+				X:  e.from.X + (e.to.X-e.from.X)*mid,
+				Y:  e.from.Y + (e.to.Y-e.from.Y)*mid,
+			}
+			if e.horizontal() {
+				b.Width, b.Height = (s1-s0)*50, s.Depth
+			} else {
+				b.Width, b.Height = s.Depth, (s1-s0)*50
+			}
+			bounds = append(bounds, b)
+		}
+	}
+	return bounds, nil
+}
+
+// edges returns the edges the strip runs along in order.
+func (s Strip) edges() ([]edge, error) {
+	start := -1
+	for i, c := range corners {
+		if c.preset == s.Start {
+			start = i
+		}
+	}
+	if start == -1 {
+		return nil, fmt.Errorf("start must be a corner")
+	}
+
+	var ends [2]int // corners at each end of a single edge
+	switch s.Edge {
+	case Whole:
+		step := 1
+		if s.Direction == CounterClockwise {
+			step = len(corners) - 1
+		}
+		var walk []edge
+		for i, c := 0, start; i < len(corners); i, c = i+1, (c+step)%len(corners) {
+			walk = append(walk, edge{corners[c].point, corners[(c+step)%len(corners)].point})
+		}
+		return walk, nil
+	case Top:
+		ends = [2]int{TopLeft, TopRight}
+	case Bottom:
+		ends = [2]int{BottomLeft, BottomRight}
+	case Left:
+		ends = [2]int{TopLeft, BottomLeft}
+	case Right:
+		ends = [2]int{TopRight, BottomRight}
+	default:
+		return nil, fmt.Errorf("edge must be top, bottom, left, right or whole")
+	}
+
+	// A single edge runs away from the start corner.
+	var from, to Point
+	switch s.Start {
+	case ends[0]:
+		from, to = cornerPoint(ends[0]), cornerPoint(ends[1])
+	case ends[1]:
+		from, to = cornerPoint(ends[1]), cornerPoint(ends[0])
+	default:
+		return nil, fmt.Errorf("start corner %s is not on the %s edge", PresetName(s.Start), PresetName(s.Edge))
+	}
+	return []edge{{from, to}}, nil
+}
+
+// cornerPoint returns where a corner preset is on the grid.
+func cornerPoint(preset int) Point {
+	for _, c := range corners {
+		if c.preset == preset {
+			return c.point
+		}
+	}
+	return Point{}
+}
@@ -0,0 +1,75 @@
+package location
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStripEdge(t *testing.T) {
+	s := Strip{Edge: Top, Count: 4, Depth: 10, Start: TopRight, FirstID: 10}
+	b, err := s.Bounds()
+	assert.NoError(t, err)
+	assert.Equal(t, Bounds{
+		{ID: 10, X: 0.75, Y: 1, Width: 25, Height: 10},
+		{ID: 11, X: 0.25, Y: 1, Width: 25, Height: 10},
+		{ID: 12, X: -0.25, Y: 1, Width: 25, Height: 10},
+		{ID: 13, X: -0.75, Y: 1, Width: 25, Height: 10},
+	}, b)
+}
+
+func TestStripGap(t *testing.T) {
+	s := Strip{Edge: Left, Count: 2, Depth: 5, Start: BottomLeft, Gap: 50, IDs: []int{7, 3}}
+	b, err := s.Bounds()
+	assert.NoError(t, err)
+	assert.Equal(t, Bounds{
+		{ID: 7, X: -1, Y: -0.75, Width: 5, Height: 25},
+		{ID: 3, X: -1, Y: 0.75, Width: 5, Height: 25},
+	}, b)
+}
+
+func TestStripPerimeter(t *testing.T) {
+	s := Strip{Edge: Whole, Count: 4, Depth: 5, Start: TopLeft, Direction: CounterClockwise}
+	b, err := s.Bounds()
+	assert.NoError(t, err)
+	assert.Equal(t, Bounds{
+		{ID: 0, X: -1, Y: 0, Width: 5, Height: 100},
+		{ID: 1, X: 0, Y: -1, Width: 100, Height: 5},
+		{ID: 2, X: 1, Y: 0, Width: 5, Height: 100},
+		{ID: 3, X: 0, Y: 1, Width: 100, Height: 5},
+	}, b)
+
+	// Segments are one and a half edges long so they wrap the corners.
+	s = Strip{Edge: Whole, Count: 2, Depth: 5, Start: TopRight, Gap: 50}
+	b, err = s.Bounds()
+	assert.NoError(t, err)
+	assert.Equal(t, Bounds{
+		{ID: 0, X: 1, Y: 0, Width: 5, Height: 100},
+		{ID: 0, X: 0.5, Y: -1, Width: 50, Height: 5},
+		{ID: 1, X: -1, Y: 0, Width: 5, Height: 100},
+		{ID: 1, X: -0.5, Y: 1, Width: 50, Height: 5},
+	}, b)
+	for _, bound := range b {
+		assert.NoError(t, bound.Validate())
+	}
+}
+
+func TestStripErrors(t *testing.T) {
+	var tests = []struct {
+		Strip    Strip
+		Expected string
+	}{
+		{Strip{Edge: Top, Count: 2, Depth: 5, Start: BottomLeft}, "start corner bottom-left corner is not on the top edge"},
+		{Strip{Edge: Top, Count: 2, Depth: 5, Start: Top}, "start must be a corner"},
+		{Strip{Edge: TopLeft, Count: 2, Depth: 5, Start: TopLeft}, "edge must be top, bottom, left, right or whole"},
+		{Strip{Edge: Top, Count: 0, Depth: 5, Start: TopLeft}, "count must be above 0"},
+		{Strip{Edge: Top, Count: 2, Depth: 0, Start: TopLeft}, "depth 0 is outside of 0 to 100%"},
+		{Strip{Edge: Top, Count: 2, Depth: 5, Start: TopLeft, IDs: []int{1}}, "has 1 ids for 2 segments"},
+		{Strip{Edge: Top, Count: 2, Depth: 5, Start: TopLeft, Gap: 100}, "gap of 100 leaves no room for 2 segments"},
+	}
+
+	for _, td := range tests {
+		_, err := td.Strip.Bounds()
+		assert.EqualError(t, err, td.Expected)
+	}
+}
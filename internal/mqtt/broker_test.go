@@ -0,0 +1,189 @@
+package mqtt
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+// broker is a minimal embedded mqtt 3.1.1 broker for tests.  Everything
+// is delivered at qos 0, retained messages and wildcards are supported.
+type broker struct {
+	ln       net.Listener
+	mu       sync.Mutex
+	clients  map[*brokerClient]bool
+	retained map[string]*packets.PublishPacket
+}
+
+type brokerClient struct {
+	conn net.Conn
+	mu   sync.Mutex
+	subs []string
+	will *packets.PublishPacket
+}
+
+func (c *brokerClient) write(p packets.ControlPacket) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	p.Write(c.conn)
+}
+
+// newBroker starts a broker on a random local port.
+func newBroker(t *testing.T) *broker {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &broker{
+		ln:       ln,
+		clients:  map[*brokerClient]bool{},
+		retained: map[string]*packets.PublishPacket{},
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(&brokerClient{conn: conn})
+		}
+	}()
+	return b
+}
+
+func (b *broker) url() string {
+	return "tcp://" + b.ln.Addr().String()
+}
+
+func (b *broker) serve(c *brokerClient) {
+	defer c.conn.Close()
+	defer func() {
+		b.mu.Lock()
+		delete(b.clients, c)
+		b.mu.Unlock()
+		if c.will != nil {
+			b.publish(c.will)
+		}
+	}()
+
+	for {
+		cp, err := packets.ReadPacket(c.conn)
+		if err != nil {
+			return
+		}
+
+		switch p := cp.(type) {
+		case *packets.ConnectPacket:
+			if p.WillFlag {
+				will := packets.NewControlPacket(packets.Publish).(*packets.PublishPacket)
+				will.TopicName = p.WillTopic
+				will.Payload = p.WillMessage
+				will.Retain = p.WillRetain
+				c.will = will
+			}
+			b.mu.Lock()
+			b.clients[c] = true
+			b.mu.Unlock()
+			c.write(packets.NewControlPacket(packets.Connack))
+
+		case *packets.SubscribePacket:
+			// Subscribe before acking, so nothing published once the
+			// client sees the ack is missed.
+			b.mu.Lock()
+			c.subs = append(c.subs, p.Topics...)
+			var retained []*packets.PublishPacket
+			for _, r := range b.retained {
+				for _, filter := range p.Topics {
+					if match(filter, r.TopicName) {
+						retained = append(retained, r)
+						break
+					}
+				}
+			}
+			b.mu.Unlock()
+
+			ack := packets.NewControlPacket(packets.Suback).(*packets.SubackPacket)
+			ack.MessageID = p.MessageID
+			ack.ReturnCodes = make([]byte, len(p.Topics))
+			c.write(ack)
+			for _, r := range retained {
+				c.write(r)
+			}
+
+		case *packets.PublishPacket:
+			if p.Qos == 1 {
+				ack := packets.NewControlPacket(packets.Puback).(*packets.PubackPacket)
+				ack.MessageID = p.MessageID
+				c.write(ack)
+			}
+			b.publish(p)
+
+		case *packets.PingreqPacket:
+			c.write(packets.NewControlPacket(packets.Pingresp))
+
+		case *packets.DisconnectPacket:
+			c.will = nil
+			return
+		}
+	}
+}
+
+// publish sends p to every matching subscriber.
+// isRetained reports whether the broker holds a retained message on topic.
+func (b *broker) isRetained(topic string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, ok := b.retained[topic]
+	return ok
+}
+
+func (b *broker) publish(p *packets.PublishPacket) {
+	out := packets.NewControlPacket(packets.Publish).(*packets.PublishPacket)
+	out.TopicName = p.TopicName
+	out.Payload = p.Payload
+
+	b.mu.Lock()
+	if p.Retain {
+		r := packets.NewControlPacket(packets.Publish).(*packets.PublishPacket)
+		r.TopicName = p.TopicName
+		r.Payload = p.Payload
+		r.Retain = true
+		b.retained[p.TopicName] = r
+	}
+	var to []*brokerClient
+	for c := range b.clients {
+		for _, filter := range c.subs {
+			if match(filter, p.TopicName) {
+				to = append(to, c)
+				break
+			}
+		}
+	}
+	b.mu.Unlock()
+
+	for _, c := range to {
+		c.write(out)
+	}
+}
+
+// match checks a topic against a subscription filter with + and #.
+func match(filter string, topic string) bool {
+	f := strings.Split(filter, "/")
+	t := strings.Split(topic, "/")
+	for i, part := range f {
+		switch {
+		case part == "#":
+			return true
+		case i >= len(t):
+			return false
+		case part != "+" && part != t[i]:
+			return false
+		}
+	}
+	return len(f) == len(t)
+}
@@ -0,0 +1,312 @@
+// Package mqtt publishes chromatic's state and colors to an mqtt broker
+// and takes commands from it, including home assistant discovery.
+package mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Khabi/chromatic/internal/chromatic"
+	"github.com/Khabi/chromatic/internal/sink"
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/lucasb-eyer/go-colorful"
+	"github.com/sirupsen/logrus"
+)
+
+// Options configures the mqtt connection.
+type Options struct {
+	Broker          string        // broker url, like tcp://localhost:1883
+	ClientID        string        // defaults to chromatic
+	Username        string        // optional
+	Password        string        // optional
+	Topic           string        // base of every topic, defaults to chromatic
+	Interval        time.Duration // how often colors and status are published, defaults to 1s
+	Discovery       bool          // publish home assistant discovery payloads
+	DiscoveryPrefix string        // home assistant discovery topic, defaults to homeassistant
+}
+
+// Client connects chromatic to an mqtt broker.
+type Client struct {
+	opts    Options
+	client  paho.Client
+	command chan<- chromatic.State
+	modes   chan<- chromatic.Mode
+	status  chan chromatic.ServerStatus
+
+	mu        sync.Mutex
+	published time.Time // last time colors were published
+
+	// loop is held while talking to the run loop, which is gone once
+	// stopped is closed.
+	loop    sync.Mutex
+	stopped chan struct{}
+}
+
+// New creates a client, commands and mode switches from the broker are
+// sent to the run loop through command and modes.
+func New(opts Options, command chan<- chromatic.State, modes chan<- chromatic.Mode, status chan chromatic.ServerStatus) *Client {
+	if opts.ClientID == "" {
+		opts.ClientID = "chromatic"
+	}
+	if opts.Topic == "" {
+		opts.Topic = "chromatic"
+	}
+	if opts.Interval == 0 {
+		opts.Interval = time.Second
+	}
+	if opts.DiscoveryPrefix == "" {
+		opts.DiscoveryPrefix = "homeassistant"
+	}
+
+	c := &Client{
+		opts:    opts,
+		command: command,
+		modes:   modes,
+		status:  status,
+		stopped: make(chan struct{}),
+	}
+
+	po := paho.NewClientOptions().
+		AddBroker(opts.Broker).
+		SetClientID(opts.ClientID).
+		SetUsername(opts.Username).
+		SetPassword(opts.Password).
+		SetAutoReconnect(true).
+		SetOrderMatters(false).
+		SetWill(c.topic("availability"), "offline", 0, true).
+		SetOnConnectHandler(c.onConnect)
+	c.client = paho.NewClient(po)
+	return c
+}
+
+// topic returns a topic under the base topic.
+func (c *Client) topic(parts ...string) string {
+	return strings.Join(append([]string{c.opts.Topic}, parts...), "/")
+}
+
+// Run connects to the broker and publishes the status every interval.
+// It returns if the first connection fails, or once it has told
+// chromatic to stop.
+func (c *Client) Run() error {
+	if token := c.client.Connect(); token.Wait() && token.Error() != nil {
+		return token.Error()
+	}
+
+	ticker := time.NewTicker(c.opts.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stopped:
+			c.client.Publish(c.topic("availability"), 0, true, "offline").Wait()
+			c.client.Disconnect(250)
+			return nil
+		case <-ticker.C:
+			c.publishStatus()
+		}
+	}
+}
+
+// isStopped reports whether stop has been sent.
+func (c *Client) isStopped() bool {
+	select {
+	case <-c.stopped:
+		return true
+	default:
+		return false
+	}
+}
+
+// onConnect runs on every connection, including reconnects.
+func (c *Client) onConnect(client paho.Client) {
+	logrus.WithField("broker", c.opts.Broker).Info("connected to mqtt")
+
+	client.Subscribe(c.topic("command"), 0, c.onCommand)
+	client.Publish(c.topic("availability"), 0, true, "online")
+	if c.opts.Discovery {
+		c.publishDiscovery()
+	}
+	c.publishStatus()
+}
+
+// onCommand handles start, pause, stop and mode <name> commands.
+func (c *Client) onCommand(client paho.Client, msg paho.Message) {
+	cmd := strings.Fields(strings.ToLower(string(msg.Payload())))
+	if len(cmd) == 0 {
+		return
+	}
+	log := logrus.WithField("command", string(msg.Payload()))
+
+	var state chromatic.State
+	var mode chromatic.Mode
+	switch {
+	case cmd[0] == "start" && len(cmd) == 1:
+		state = chromatic.Running
+	case cmd[0] == "pause" && len(cmd) == 1:
+		state = chromatic.Paused
+	case cmd[0] == "stop" && len(cmd) == 1:
+		state = chromatic.Stop
+	case cmd[0] == "mode" && len(cmd) == 2:
+		var err error
+		if mode, err = chromatic.ParseMode(cmd[1]); err != nil {
+			log.WithError(err).Warn("invalid mqtt command")
+			return
+		}
+	default:
+		log.Warn("unknown mqtt command")
+		return
+	}
+
+	c.loop.Lock()
+	if c.isStopped() {
+		c.loop.Unlock()
+		log.Warn("chromatic is stopping, ignoring mqtt command")
+		return
+	}
+	if cmd[0] == "mode" {
+		c.modes <- mode
+	} else {
+		c.command <- state
+	}
+	if state == chromatic.Stop {
+		close(c.stopped)
+	}
+	c.loop.Unlock()
+
+	log.Info("mqtt command")
+	c.publishStatus()
+}
+
+// publishStatus asks the run loop for its status and publishes it.
+func (c *Client) publishStatus() {
+	if !c.client.IsConnected() {
+		return
+	}
+	c.loop.Lock()
+	if c.isStopped() {
+		c.loop.Unlock()
+		return
+	}
+	c.command <- chromatic.Status
+	status := <-c.status
+	c.loop.Unlock()
+
+	c.client.Publish(c.topic("state"), 0, true, status.State)
+	c.client.Publish(c.topic("mode"), 0, true, status.Mode)
+	c.client.Publish(c.topic("fps"), 0, false, strconv.FormatInt(status.FPS, 10))
+}
+
+// publishColors publishes the hex color of each light, at most once
+// every interval.
+func (c *Client) publishColors(colors map[int]colorful.Color) {
+	c.mu.Lock()
+	if time.Since(c.published) < c.opts.Interval || !c.client.IsConnected() {
+		c.mu.Unlock()
+		return
+	}
+	c.published = time.Now()
+	c.mu.Unlock()
+
+	for id, clr := range colors {
+		c.client.Publish(c.topic("light", strconv.Itoa(id)), 0, false, clr.Clamped().Hex())
+	}
+}
+
+// publishDiscovery tells home assistant about a switch to start and
+// pause chromatic, and sensors for its fps and mode.
+func (c *Client) publishDiscovery() {
+	id := strings.ReplaceAll(c.opts.ClientID, "/", "_")
+	device := map[string]interface{}{
+		"identifiers": []string{id},
+		"name":        c.opts.ClientID,
+		"model":       "chromatic",
+	}
+
+	configs := map[string]map[string]interface{}{
+		"switch": {
+			"name":          c.opts.ClientID,
+			"command_topic": c.topic("command"),
+			"state_topic":   c.topic("state"),
+			"payload_on":    "start",
+			"payload_off":   "pause",
+			"state_on":      "running",
+			"state_off":     "paused",
+			"icon":          "mdi:television-ambient-light",
+		},
+		"sensor/fps": {
+			"name":                c.opts.ClientID + " fps",
+			"state_topic":         c.topic("fps"),
+			"unit_of_measurement": "fps",
+			"icon":                "mdi:speedometer",
+		},
+		"sensor/mode": {
+			"name":        c.opts.ClientID + " mode",
+			"state_topic": c.topic("mode"),
+			"icon":        "mdi:palette",
+		},
+	}
+
+	for kind, cfg := range configs {
+		component, object := kind, "state"
+		if i := strings.Index(kind, "/"); i != -1 {
+			component, object = kind[:i], kind[i+1:]
+		}
+
+		cfg["unique_id"] = fmt.Sprintf("%s_%s", id, object)
+		cfg["availability_topic"] = c.topic("availability")
+		cfg["device"] = device
+
+		payload, err := json.Marshal(cfg)
+		if err != nil {
+			logrus.WithError(err).Error("unable to build discovery payload")
+			continue
+		}
+		topic := fmt.Sprintf("%s/%s/%s/%s/config", c.opts.DiscoveryPrefix, component, id, object)
+		c.client.Publish(topic, 0, true, payload)
+	}
+}
+
+// Wrap returns a sink that publishes every color set on s.
+func (c *Client) Wrap(s sink.Sink) sink.Sink {
+	return &colorSink{Sink: s, client: c}
+}
+
+// colorSink passes colors through to another sink, publishing them
+// on the way.
+type colorSink struct {
+	sink.Sink
+	client *Client
+}
+
+func (s *colorSink) Set(colors map[int]colorful.Color) error {
+	s.client.publishColors(colors)
+	return s.Sink.Set(colors)
+}
+
+// Unwrap returns the sink colors are passed to.
+func (s *colorSink) Unwrap() sink.Sink {
+	return s.Sink
+}
+
+// Sink returns a sink that only publishes colors, for an output that
+// has its own bindings.
+func (c *Client) Sink() sink.Sink {
+	return &publishSink{client: c}
+}
+
+// publishSink publishes colors without driving any lights.
+type publishSink struct {
+	client *Client
+}
+
+func (s *publishSink) Start() error { return nil }
+
+func (s *publishSink) Set(colors map[int]colorful.Color) error {
+	s.client.publishColors(colors)
+	return nil
+}
+
+func (s *publishSink) Stop() error { return nil }
@@ -0,0 +1,233 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Khabi/chromatic/internal/chromatic"
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/lucasb-eyer/go-colorful"
+	"github.com/stretchr/testify/assert"
+)
+
+// loop stands in for chromatic.Run, answering status requests and
+// passing every other command on.
+func loop(command <-chan chromatic.State, status chan<- chromatic.ServerStatus) <-chan chromatic.State {
+	got := make(chan chromatic.State, 10)
+	go func() {
+		for cmd := range command {
+			if cmd == chromatic.Status {
+				status <- chromatic.ServerStatus{State: "paused", FPS: 12, Mode: "average"}
+				continue
+			}
+			got <- cmd
+		}
+	}()
+	return got
+}
+
+// inbox keeps the messages seen on the broker by topic, so waiting for
+// one topic doesn't lose messages on the others.
+type inbox struct {
+	msgs chan paho.Message
+	seen map[string][]string
+}
+
+// observe subscribes to every topic on the broker.
+func observe(t *testing.T, b *broker) *inbox {
+	in := &inbox{msgs: make(chan paho.Message, 100), seen: make(map[string][]string)}
+	o := paho.NewClient(paho.NewClientOptions().AddBroker(b.url()).SetClientID("observer"))
+	if token := o.Connect(); token.Wait() && token.Error() != nil {
+		t.Fatal(token.Error())
+	}
+	t.Cleanup(func() { o.Disconnect(0) })
+
+	token := o.Subscribe("#", 0, func(_ paho.Client, m paho.Message) { in.msgs <- m })
+	token.Wait()
+	return in
+}
+
+// next returns the payload of the next message on topic, waiting up to
+// timeout for it.
+func (in *inbox) next(topic string, timeout time.Duration) (string, bool) {
+	deadline := time.After(timeout)
+	for len(in.seen[topic]) == 0 {
+		select {
+		case m := <-in.msgs:
+			in.seen[m.Topic()] = append(in.seen[m.Topic()], string(m.Payload()))
+		case <-deadline:
+			return "", false
+		}
+	}
+	payload := in.seen[topic][0]
+	in.seen[topic] = in.seen[topic][1:]
+	return payload, true
+}
+
+// waitFor returns the payload of the next message on topic.
+func (in *inbox) waitFor(t *testing.T, topic string) string {
+	payload, ok := in.next(topic, 2*time.Second)
+	if !ok {
+		t.Fatalf("no message on %s", topic)
+	}
+	return payload
+}
+
+type fakeSink struct {
+	sets int
+}
+
+func (f *fakeSink) Start() error                            { return nil }
+func (f *fakeSink) Set(colors map[int]colorful.Color) error { f.sets++; return nil }
+func (f *fakeSink) Stop() error                             { return nil }
+
+func TestClient(t *testing.T) {
+	b := newBroker(t)
+	msgs := observe(t, b)
+
+	command := make(chan chromatic.State)
+	modes := make(chan chromatic.Mode, 1)
+	status := make(chan chromatic.ServerStatus)
+	got := loop(command, status)
+
+	c := New(Options{Broker: b.url(), Discovery: true, Interval: time.Hour}, command, modes, status)
+	go c.Run()
+
+	assert.Equal(t, "online", msgs.waitFor(t, "chromatic/availability"))
+	assert.Equal(t, "paused", msgs.waitFor(t, "chromatic/state"))
+	assert.Equal(t, "12", msgs.waitFor(t, "chromatic/fps"))
+
+	// Commands
+	publish := paho.NewClient(paho.NewClientOptions().AddBroker(b.url()).SetClientID("publisher"))
+	publish.Connect().Wait()
+	defer publish.Disconnect(0)
+
+	publish.Publish("chromatic/command", 0, false, "start").Wait()
+	select {
+	case cmd := <-got:
+		assert.Equal(t, chromatic.Running, cmd)
+	case <-time.After(2 * time.Second):
+		t.Fatal("start command not received")
+	}
+
+	publish.Publish("chromatic/command", 0, false, "mode prominent").Wait()
+	select {
+	case m := <-modes:
+		assert.Equal(t, chromatic.Prominent, m)
+	case <-time.After(2 * time.Second):
+		t.Fatal("mode command not received")
+	}
+
+	// Colors are passed through and throttled.
+	f := &fakeSink{}
+	s := c.Wrap(f)
+	assert.NoError(t, s.Set(map[int]colorful.Color{1: {R: 1, G: 0, B: 0}}))
+	assert.NoError(t, s.Set(map[int]colorful.Color{1: {R: 0, G: 0, B: 1}}))
+	assert.Equal(t, 2, f.sets)
+	assert.Equal(t, "#ff0000", msgs.waitFor(t, "chromatic/light/1"))
+	if _, ok := msgs.next("chromatic/light/1", 100*time.Millisecond); ok {
+		t.Fatal("colors were not throttled")
+	}
+
+	// An mqtt output publishes without a sink behind it.
+	p := c.Sink()
+	assert.NoError(t, p.Start())
+	assert.NoError(t, p.Set(map[int]colorful.Color{1: {R: 0, G: 1, B: 0}}))
+	assert.NoError(t, p.Stop())
+}
+
+func TestDiscovery(t *testing.T) {
+	b := newBroker(t)
+
+	command := make(chan chromatic.State)
+	status := make(chan chromatic.ServerStatus)
+	loop(command, status)
+
+	c := New(Options{Broker: b.url(), ClientID: "tv", Topic: "home/tv", Discovery: true, Interval: time.Hour}, command, nil, status)
+	go c.Run()
+
+	// Discovery payloads are retained, so a late subscriber still sees them.
+	assert.Eventually(t, func() bool {
+		return b.isRetained("homeassistant/switch/tv/state/config") && b.isRetained("homeassistant/sensor/tv/fps/config")
+	}, 2*time.Second, 10*time.Millisecond)
+	msgs := observe(t, b)
+
+	var sw map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(msgs.waitFor(t, "homeassistant/switch/tv/state/config")), &sw))
+	assert.Equal(t, "home/tv/command", sw["command_topic"])
+	assert.Equal(t, "home/tv/state", sw["state_topic"])
+	assert.Equal(t, "start", sw["payload_on"])
+	assert.Equal(t, "tv_state", sw["unique_id"])
+	assert.Equal(t, "home/tv/availability", sw["availability_topic"])
+
+	var fps map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(msgs.waitFor(t, "homeassistant/sensor/tv/fps/config")), &fps))
+	assert.Equal(t, "home/tv/fps", fps["state_topic"])
+	assert.Equal(t, "fps", fps["unit_of_measurement"])
+}
+
+func TestStop(t *testing.T) {
+	b := newBroker(t)
+	msgs := observe(t, b)
+
+	// The run loop returns once told to stop, like chromatic.Run.
+	command := make(chan chromatic.State)
+	status := make(chan chromatic.ServerStatus)
+	got := make(chan chromatic.State, 10)
+	go func() {
+		for cmd := range command {
+			if cmd == chromatic.Status {
+				status <- chromatic.ServerStatus{State: "running"}
+				continue
+			}
+			got <- cmd
+			if cmd == chromatic.Stop {
+				return
+			}
+		}
+	}()
+
+	c := New(Options{Broker: b.url(), Interval: 10 * time.Millisecond}, command, nil, status)
+	ran := make(chan error)
+	go func() { ran <- c.Run() }()
+	assert.Equal(t, "online", msgs.waitFor(t, "chromatic/availability"))
+
+	publish := paho.NewClient(paho.NewClientOptions().AddBroker(b.url()).SetClientID("publisher"))
+	publish.Connect().Wait()
+	defer publish.Disconnect(0)
+	publish.Publish("chromatic/command", 0, false, "stop").Wait()
+
+	select {
+	case err := <-ran:
+		assert.NoError(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("client kept running after stop")
+	}
+	assert.Equal(t, chromatic.Stop, <-got)
+	assert.Equal(t, "offline", msgs.waitFor(t, "chromatic/availability"))
+
+	// Nothing is sent to the run loop once it is gone.
+	done := make(chan struct{})
+	go func() {
+		c.publishStatus()
+		c.onCommand(nil, fakeMessage("start"))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("blocked on the stopped run loop")
+	}
+}
+
+// fakeMessage is a message on the command topic.
+type fakeMessage string
+
+func (m fakeMessage) Duplicate() bool   { return false }
+func (m fakeMessage) Qos() byte         { return 0 }
+func (m fakeMessage) Retained() bool    { return false }
+func (m fakeMessage) Topic() string     { return "chromatic/command" }
+func (m fakeMessage) MessageID() uint16 { return 0 }
+func (m fakeMessage) Payload() []byte   { return []byte(m) }
+func (m fakeMessage) Ack()              {}
@@ -0,0 +1,111 @@
+package sink
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+// adalightMagic starts every adalight frame.
+var adalightMagic = []byte("Ada")
+
+// Adalight drives an arduino, or anything else running an adalight
+// sketch, over a serial port.
+type Adalight struct {
+	device string
+	baud   int
+	order  [3]int // where red, green and blue go in each triplet
+	layout Layout
+	port   io.WriteCloser
+}
+
+// NewAdalight creates a sink for the serial device.  Order is the
+// order the leds expect each color in, like rgb or grb.
+func NewAdalight(device string, baud int, order string, layout Layout) (*Adalight, error) {
+	if err := layout.Validate(); err != nil {
+		return nil, err
+	}
+	if layout.Pixels > 0x10000 {
+		return nil, fmt.Errorf("adalight supports up to %d pixels", 0x10000)
+	}
+	if _, err := baudRate(baud); err != nil {
+		return nil, err
+	}
+	o, err := parseOrder(order)
+	if err != nil {
+		return nil, err
+	}
+	return &Adalight{device: device, baud: baud, order: o, layout: layout}, nil
+}
+
+// parseOrder converts an order like grb in to the position of red,
+// green and blue.
+func parseOrder(order string) ([3]int, error) {
+	var o [3]int
+	order = strings.ToLower(order)
+	if order == "" {
+		order = "rgb"
+	}
+	if len(order) != 3 {
+		return o, fmt.Errorf("unknown color order %q, expected something like rgb or grb", order)
+	}
+	for i, c := range "rgb" {
+		pos := strings.IndexRune(order, c)
+		if pos == -1 {
+			return o, fmt.Errorf("unknown color order %q, expected something like rgb or grb", order)
+		}
+		o[i] = pos
+	}
+	return o, nil
+}
+
+// Start opens the serial port.
+func (a *Adalight) Start() error {
+	if a.port != nil {
+		return nil
+	}
+	port, err := openSerial(a.device, a.baud)
+	if err != nil {
+		return err
+	}
+	a.port = port
+	return nil
+}
+
+// Set writes a frame, the header holds the led count minus one and
+// a checksum of it.
+func (a *Adalight) Set(colors map[int]colorful.Color) error {
+	if a.port == nil {
+		return fmt.Errorf("sink is not started")
+	}
+
+	frame := a.layout.Frame(colors)
+	count := a.layout.Pixels - 1
+	hi, lo := byte(count>>8), byte(count)
+
+	packet := make([]byte, 0, len(adalightMagic)+3+len(frame))
+	packet = append(packet, adalightMagic...)
+	packet = append(packet, hi, lo, hi^lo^0x55)
+	for i := 0; i < len(frame); i += 3 {
+		var p [3]byte
+		for c := 0; c < 3; c++ {
+			p[a.order[c]] = frame[i+c]
+		}
+		packet = append(packet, p[:]...)
+	}
+
+	_, err := a.port.Write(packet)
+	return err
+}
+
+// Stop closes the serial port.
+func (a *Adalight) Stop() error {
+	if a.port == nil {
+		return nil
+	}
+	err := a.port.Close()
+	a.port = nil
+	return err
+}
@@ -0,0 +1,75 @@
+package sink
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/lucasb-eyer/go-colorful"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+// openPty returns the master side of a new pseudo-terminal and the
+// path of its slave for the sink to open.
+func openPty(t *testing.T) (*os.File, string) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		t.Skip("no pty support:", err)
+	}
+	t.Cleanup(func() { master.Close() })
+
+	if err := unix.IoctlSetPointerInt(int(master.Fd()), unix.TIOCSPTLCK, 0); err != nil {
+		t.Fatal(err)
+	}
+	n, err := unix.IoctlGetInt(int(master.Fd()), unix.TIOCGPTN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return master, fmt.Sprintf("/dev/pts/%d", n)
+}
+
+func TestAdalight(t *testing.T) {
+	var tests = []struct {
+		name     string
+		order    string
+		expected []byte
+	}{
+		{"rgb", "rgb", []byte{'A', 'd', 'a', 0, 2, 0x57, 255, 0, 0, 0, 0, 0, 0, 128, 255}},
+		{"grb", "GRB", []byte{'A', 'd', 'a', 0, 2, 0x57, 0, 255, 0, 0, 0, 0, 128, 0, 255}},
+	}
+
+	for _, td := range tests {
+		t.Run(td.name, func(t *testing.T) {
+			master, slave := openPty(t)
+
+			a, err := NewAdalight(slave, 115200, td.order, Layout{Pixels: 3, Map: map[int][]int{1: {0}, 2: {2}}})
+			assert.NoError(t, err)
+			assert.NoError(t, a.Start())
+			defer a.Stop()
+
+			assert.NoError(t, a.Set(map[int]colorful.Color{
+				1: red,
+				2: {R: 0, G: 0.5, B: 1},
+			}))
+
+			got := make([]byte, len(td.expected))
+			_, err = io.ReadFull(master, got)
+			assert.NoError(t, err)
+			assert.Equal(t, td.expected, got)
+		})
+	}
+}
+
+func TestAdalightOptions(t *testing.T) {
+	_, err := NewAdalight("/dev/ttyUSB0", 12345, "rgb", Layout{Pixels: 1})
+	assert.EqualError(t, err, "unsupported baud rate 12345")
+	_, err = NewAdalight("/dev/ttyUSB0", 115200, "rgbw", Layout{Pixels: 1})
+	assert.EqualError(t, err, `unknown color order "rgbw", expected something like rgb or grb`)
+	_, err = NewAdalight("/dev/ttyUSB0", 115200, "rrb", Layout{Pixels: 1})
+	assert.Error(t, err)
+
+	_, err = openSerial("/dev/null", 115200)
+	assert.Error(t, err)
+}
@@ -0,0 +1,83 @@
+package sink
+
+import (
+	"encoding/binary"
+	"net"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+// DDP packet details, see http://www.3waylabs.com/ddp/
+const (
+	DDPPort = 4048
+
+	ddpHeaderLen = 10
+	ddpMaxData   = 1440 // 480 pixels, keeps packets under a typical MTU
+
+	ddpVersion1 = 0x40
+	ddpPush     = 0x01
+	ddpTypeRGB8 = 0x0b
+	ddpDisplay  = 0x01
+)
+
+// DDP drives a strip with the distributed display protocol,
+// which WLED and most pixel controllers understand.
+type DDP struct {
+	udp
+	addr     *net.UDPAddr
+	layout   Layout
+	sequence byte
+}
+
+// NewDDP creates a sink for the device at address.
+func NewDDP(address string, layout Layout) (*DDP, error) {
+	if err := layout.Validate(); err != nil {
+		return nil, err
+	}
+	addr, err := resolve(address, DDPPort)
+	if err != nil {
+		return nil, err
+	}
+	return &DDP{addr: addr, layout: layout}, nil
+}
+
+// Start opens the socket.
+func (d *DDP) Start() error {
+	return d.start()
+}
+
+// Set sends the frame, split across as many packets as needed.  Only the
+// last packet is flagged to push so the device updates all at once.
+func (d *DDP) Set(colors map[int]colorful.Color) error {
+	frame := d.layout.Frame(colors)
+	d.sequence = d.sequence%15 + 1 // 1-15, 0 means unused
+
+	for start := 0; start < len(frame); start += ddpMaxData {
+		end := start + ddpMaxData
+		if end > len(frame) {
+			end = len(frame)
+		}
+
+		packet := make([]byte, ddpHeaderLen+end-start)
+		packet[0] = ddpVersion1
+		if end == len(frame) {
+			packet[0] |= ddpPush
+		}
+		packet[1] = d.sequence
+		packet[2] = ddpTypeRGB8
+		packet[3] = ddpDisplay
+		binary.BigEndian.PutUint32(packet[4:], uint32(d.layout.Offset*3+start))
+		binary.BigEndian.PutUint16(packet[8:], uint16(end-start))
+		copy(packet[ddpHeaderLen:], frame[start:end])
+
+		if err := d.send(d.addr, packet); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stop closes the socket.
+func (d *DDP) Stop() error {
+	return d.stop()
+}
@@ -0,0 +1,44 @@
+package sink
+
+import (
+	"testing"
+
+	"github.com/lucasb-eyer/go-colorful"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDDP(t *testing.T) {
+	conn, addr := listen(t)
+
+	d, err := NewDDP(addr, Layout{Pixels: 2, Offset: 10})
+	assert.NoError(t, err)
+	assert.NoError(t, d.Start())
+	defer d.Stop()
+
+	assert.NoError(t, d.Set(map[int]colorful.Color{0: red, 1: blue}))
+	assert.Equal(t, []byte{
+		0x41, 1, 0x0b, 1, // push, sequence, rgb, display
+		0, 0, 0, 30, // offset in bytes
+		0, 6, // length
+		255, 0, 0, 0, 0, 255,
+	}, receive(t, conn))
+}
+
+func TestDDPSplit(t *testing.T) {
+	conn, addr := listen(t)
+
+	d, err := NewDDP(addr, Layout{Pixels: 500})
+	assert.NoError(t, err)
+	assert.NoError(t, d.Start())
+	defer d.Stop()
+
+	assert.NoError(t, d.Set(map[int]colorful.Color{499: red}))
+
+	first := receive(t, conn)
+	assert.Equal(t, []byte{0x40, 1, 0x0b, 1, 0, 0, 0, 0, 0x05, 0xa0}, first[:ddpHeaderLen])
+	assert.Len(t, first, ddpHeaderLen+1440)
+
+	last := receive(t, conn)
+	assert.Equal(t, []byte{0x41, 1, 0x0b, 1, 0, 0, 0x05, 0xa0, 0, 60}, last[:ddpHeaderLen])
+	assert.Equal(t, []byte{255, 0, 0}, last[len(last)-3:])
+}
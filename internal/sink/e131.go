@@ -0,0 +1,133 @@
+package sink
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+// E1.31 (sACN) packet details.
+const (
+	E131Port = 5568
+
+	e131HeaderLen         = 126
+	e131PixelsPerUniverse = 170 // 510 of the 512 dmx channels
+	e131Priority          = 100
+	e131MaxUniverse       = 63999
+)
+
+var e131PacketID = []byte("ASC-E1.17\x00\x00\x00")
+
+// E131 drives pixels over e1.31 streaming dmx.  Pixels past the end of a
+// universe carry on in the next one.
+type E131 struct {
+	udp
+	addr     *net.UDPAddr // nil to multicast each universe
+	universe int
+	layout   Layout
+	cid      [16]byte
+	sequence map[int]byte
+}
+
+// NewE131 creates a sink starting at universe.  An empty address sends
+// to the multicast group of each universe.
+func NewE131(address string, universe int, layout Layout) (*E131, error) {
+	if err := layout.Validate(); err != nil {
+		return nil, err
+	}
+	last := universe + (layout.Offset+layout.Pixels-1)/e131PixelsPerUniverse
+	if universe < 1 || last > e131MaxUniverse {
+		return nil, fmt.Errorf("universes %d to %d are outside of 1 to %d", universe, last, e131MaxUniverse)
+	}
+
+	e := &E131{universe: universe, layout: layout, sequence: map[int]byte{}}
+	if address != "" {
+		addr, err := resolve(address, E131Port)
+		if err != nil {
+			return nil, err
+		}
+		e.addr = addr
+	}
+	if _, err := rand.Read(e.cid[:]); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Start opens the socket.
+func (e *E131) Start() error {
+	return e.start()
+}
+
+// Set sends a packet for every universe the pixels cover.
+func (e *E131) Set(colors map[int]colorful.Color) error {
+	frame := e.layout.Frame(colors)
+
+	// Channel data for each universe, offset by the first pixel.
+	data := map[int][]byte{}
+	var universes []int
+	for i := 0; i < e.layout.Pixels; i++ {
+		pixel := e.layout.Offset + i
+		u := e.universe + pixel/e131PixelsPerUniverse
+		if _, ok := data[u]; !ok {
+			universes = append(universes, u)
+		}
+		ch := (pixel % e131PixelsPerUniverse) * 3
+		for len(data[u]) < ch+3 {
+			data[u] = append(data[u], 0)
+		}
+		copy(data[u][ch:], frame[i*3:i*3+3])
+	}
+
+	for _, u := range universes {
+		addr := e.addr
+		if addr == nil {
+			addr = &net.UDPAddr{IP: net.IPv4(239, 255, byte(u>>8), byte(u)), Port: E131Port}
+		}
+		e.sequence[u]++
+		if err := e.send(addr, e.packet(u, e.sequence[u], data[u])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// packet builds an e1.31 data packet, the root, framing and dmp layers.
+func (e *E131) packet(universe int, sequence byte, channels []byte) []byte {
+	n := len(channels)
+	p := make([]byte, e131HeaderLen+n)
+
+	// Root layer
+	binary.BigEndian.PutUint16(p[0:], 0x0010) // preamble size
+	copy(p[4:], e131PacketID)
+	binary.BigEndian.PutUint16(p[16:], 0x7000|uint16(110+n))
+	binary.BigEndian.PutUint32(p[18:], 0x00000004) // VECTOR_ROOT_E131_DATA
+	copy(p[22:], e.cid[:])
+
+	// Framing layer
+	binary.BigEndian.PutUint16(p[38:], 0x7000|uint16(88+n))
+	binary.BigEndian.PutUint32(p[40:], 0x00000002) // VECTOR_E131_DATA_PACKET
+	copy(p[44:108], "chromatic")
+	p[108] = e131Priority
+	p[111] = sequence
+	binary.BigEndian.PutUint16(p[113:], uint16(universe))
+
+	// DMP layer
+	binary.BigEndian.PutUint16(p[115:], 0x7000|uint16(11+n))
+	p[117] = 0x02                               // VECTOR_DMP_SET_PROPERTY
+	p[118] = 0xa1                               // address and data type
+	binary.BigEndian.PutUint16(p[121:], 0x0001) // address increment
+	binary.BigEndian.PutUint16(p[123:], uint16(n+1))
+	p[125] = 0x00 // dmx start code
+	copy(p[e131HeaderLen:], channels)
+
+	return p
+}
+
+// Stop closes the socket.
+func (e *E131) Stop() error {
+	return e.stop()
+}
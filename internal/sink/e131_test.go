@@ -0,0 +1,44 @@
+package sink
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/lucasb-eyer/go-colorful"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestE131(t *testing.T) {
+	conn, addr := listen(t)
+
+	// Pixel 169 is the last of universe 2, pixel 170 starts universe 3.
+	e, err := NewE131(addr, 2, Layout{Pixels: 2, Offset: 169})
+	assert.NoError(t, err)
+	assert.NoError(t, e.Start())
+	defer e.Stop()
+
+	assert.NoError(t, e.Set(map[int]colorful.Color{0: red, 1: blue}))
+
+	p := receive(t, conn)
+	assert.Equal(t, e131PacketID, p[4:16])
+	assert.Equal(t, e.cid[:], p[22:38])
+	assert.Equal(t, "chromatic", string(p[44:53]))
+	assert.Equal(t, uint16(2), binary.BigEndian.Uint16(p[113:]))
+	assert.Equal(t, uint16(511), binary.BigEndian.Uint16(p[123:]))
+	assert.Equal(t, uint16(0x7000|(110+510)), binary.BigEndian.Uint16(p[16:]))
+	assert.Len(t, p, e131HeaderLen+510)
+	assert.Equal(t, []byte{255, 0, 0}, p[len(p)-3:])
+	assert.Equal(t, byte(1), p[111])
+
+	p = receive(t, conn)
+	assert.Equal(t, uint16(3), binary.BigEndian.Uint16(p[113:]))
+	assert.Equal(t, uint16(4), binary.BigEndian.Uint16(p[123:]))
+	assert.Equal(t, []byte{0, 0, 255}, p[e131HeaderLen:])
+}
+
+func TestE131Universe(t *testing.T) {
+	_, err := NewE131("", 0, Layout{Pixels: 1})
+	assert.EqualError(t, err, "universes 0 to 0 are outside of 1 to 63999")
+	_, err = NewE131("", 63999, Layout{Pixels: 171})
+	assert.EqualError(t, err, "universes 63999 to 64000 are outside of 1 to 63999")
+}
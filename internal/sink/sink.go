@@ -0,0 +1,140 @@
+// Package sink holds the outputs that sampled colors are sent to.
+package sink
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+// Sink is an output that lights are driven through.
+type Sink interface {
+	// Start opens the output, it is called when capture starts.
+	Start() error
+	// Set sends the color of each light, keyed by bound ID.
+	Set(colors map[int]colorful.Color) error
+	// Stop closes the output, it is called when capture pauses.
+	Stop() error
+}
+
+// Health is how an output that keeps a connection open is doing.
+type Health struct {
+	Connected  bool   `json:"connected"`
+	Reason     string `json:"reason,omitempty"` // why it last disconnected
+	Reconnects int    `json:"reconnects"`
+}
+
+// Monitored is a sink that reports its health.
+type Monitored interface {
+	Health() Health
+}
+
+// HealthOf returns the health of s, looking through sinks that wrap
+// another with an Unwrap method.
+func HealthOf(s Sink) (Health, bool) {
+	for s != nil {
+		if m, ok := s.(Monitored); ok {
+			return m.Health(), true
+		}
+		w, ok := s.(interface{ Unwrap() Sink })
+		if !ok {
+			break
+		}
+		s = w.Unwrap()
+	}
+	return Health{}, false
+}
+
+// Layout maps bound IDs on to the pixels of an addressable strip.
+type Layout struct {
+	Pixels int           // number of pixels the sink drives
+	Offset int           // first pixel on the device
+	Map    map[int][]int // bound ID to the pixels it lights, by default pixel n is ID n
+}
+
+// Frame returns the RGB values of every pixel, pixels without a
+// color are left off.
+func (l Layout) Frame(colors map[int]colorful.Color) []byte {
+	frame := make([]byte, l.Pixels*3)
+	set := func(pixel int, c colorful.Color) {
+		if pixel < 0 || pixel >= l.Pixels {
+			return
+		}
+		frame[pixel*3], frame[pixel*3+1], frame[pixel*3+2] = c.Clamped().RGB255()
+	}
+
+	for id, c := range colors {
+		if l.Map == nil {
+			set(id, c)
+			continue
+		}
+		for _, pixel := range l.Map[id] {
+			set(pixel, c)
+		}
+	}
+	return frame
+}
+
+// Validate checks that the layout fits on the device.
+func (l Layout) Validate() error {
+	if l.Pixels <= 0 {
+		return fmt.Errorf("pixels must be above 0")
+	}
+	if l.Offset < 0 {
+		return fmt.Errorf("offset can't be negative")
+	}
+	for id, pixels := range l.Map {
+		for _, p := range pixels {
+			if p < 0 || p >= l.Pixels {
+				return fmt.Errorf("bound %d maps to pixel %d, outside of 0 to %d", id, p, l.Pixels-1)
+			}
+		}
+	}
+	return nil
+}
+
+// udp sends packets from an unconnected socket so a sink can
+// address several destinations, like e1.31 multicast groups.
+type udp struct {
+	conn *net.UDPConn
+}
+
+func (u *udp) start() error {
+	if u.conn != nil {
+		return nil
+	}
+	conn, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return err
+	}
+	u.conn = conn
+	return nil
+}
+
+func (u *udp) send(addr *net.UDPAddr, packet []byte) error {
+	if u.conn == nil {
+		return fmt.Errorf("sink is not started")
+	}
+	_, err := u.conn.WriteToUDP(packet, addr)
+	return err
+}
+
+func (u *udp) stop() error {
+	if u.conn == nil {
+		return nil
+	}
+	err := u.conn.Close()
+	u.conn = nil
+	return err
+}
+
+// resolve looks up a device address, adding the protocols port
+// when one isn't given.
+func resolve(address string, port int) (*net.UDPAddr, error) {
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, strconv.Itoa(port))
+	}
+	return net.ResolveUDPAddr("udp", address)
+}
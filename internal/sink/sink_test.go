@@ -0,0 +1,107 @@
+package sink
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lucasb-eyer/go-colorful"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	red  = colorful.Color{R: 1, G: 0, B: 0}
+	blue = colorful.Color{R: 0, G: 0, B: 1}
+)
+
+// listen starts a local udp listener for a sink to send to.
+func listen(t *testing.T) (*net.UDPConn, string) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn, conn.LocalAddr().String()
+}
+
+// receive waits for the next packet.
+func receive(t *testing.T, conn *net.UDPConn) []byte {
+	buf := make([]byte, 65535)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf[:n]
+}
+
+func TestFrame(t *testing.T) {
+	var tests = []struct {
+		name     string
+		layout   Layout
+		expected []byte
+	}{
+		{
+			"pixel per id",
+			Layout{Pixels: 3},
+			[]byte{255, 0, 0, 0, 0, 255, 0, 0, 0},
+		},
+		{
+			"mapped",
+			Layout{Pixels: 4, Map: map[int][]int{0: {3}, 1: {0, 1}}},
+			[]byte{0, 0, 255, 0, 0, 255, 0, 0, 0, 255, 0, 0},
+		},
+		{
+			"ids past the end",
+			Layout{Pixels: 1},
+			[]byte{255, 0, 0},
+		},
+	}
+
+	for _, td := range tests {
+		t.Run(td.name, func(t *testing.T) {
+			f := td.layout.Frame(map[int]colorful.Color{0: red, 1: blue})
+			assert.Equal(t, td.expected, f)
+		})
+	}
+}
+
+func TestLayoutValidate(t *testing.T) {
+	assert.NoError(t, Layout{Pixels: 2, Map: map[int][]int{5: {1}}}.Validate())
+	assert.EqualError(t, Layout{}.Validate(), "pixels must be above 0")
+	assert.EqualError(t, Layout{Pixels: 2, Offset: -1}.Validate(), "offset can't be negative")
+	assert.EqualError(t, Layout{Pixels: 2, Map: map[int][]int{5: {2}}}.Validate(), "bound 5 maps to pixel 2, outside of 0 to 1")
+}
+
+func TestNotStarted(t *testing.T) {
+	_, addr := listen(t)
+	d, err := NewDDP(addr, Layout{Pixels: 1})
+	assert.NoError(t, err)
+	assert.EqualError(t, d.Set(nil), "sink is not started")
+}
+
+type monitored struct {
+	Sink
+	health Health
+}
+
+func (m monitored) Health() Health { return m.health }
+
+type wrapper struct{ Sink }
+
+func (w wrapper) Unwrap() Sink { return w.Sink }
+
+func TestHealthOf(t *testing.T) {
+	down := Health{Reason: "bridge ended the stream", Reconnects: 2}
+
+	h, ok := HealthOf(monitored{health: down})
+	assert.True(t, ok)
+	assert.Equal(t, down, h)
+
+	h, ok = HealthOf(wrapper{monitored{health: down}})
+	assert.True(t, ok)
+	assert.Equal(t, down, h)
+
+	_, ok = HealthOf(wrapper{})
+	assert.False(t, ok)
+}
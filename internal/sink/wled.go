@@ -0,0 +1,70 @@
+package sink
+
+import (
+	"encoding/binary"
+	"net"
+
+	"github.com/lucasb-eyer/go-colorful"
+)
+
+// WLED realtime udp details, see https://kno.wled.ge/interfaces/udp-realtime/
+const (
+	WLEDPort = 21324
+
+	wledDNRGB      = 4   // rgb with a starting index
+	wledMaxPixels  = 489 // pixels per DNRGB packet
+	wledTimeout    = 2   // seconds before WLED goes back to its own effects
+	wledHeaderSize = 4
+)
+
+// WLED drives a strip with WLED's realtime udp protocol.
+type WLED struct {
+	udp
+	addr   *net.UDPAddr
+	layout Layout
+}
+
+// NewWLED creates a sink for the WLED device at address.
+func NewWLED(address string, layout Layout) (*WLED, error) {
+	if err := layout.Validate(); err != nil {
+		return nil, err
+	}
+	addr, err := resolve(address, WLEDPort)
+	if err != nil {
+		return nil, err
+	}
+	return &WLED{addr: addr, layout: layout}, nil
+}
+
+// Start opens the socket.
+func (w *WLED) Start() error {
+	return w.start()
+}
+
+// Set sends the frame in DNRGB packets.
+func (w *WLED) Set(colors map[int]colorful.Color) error {
+	frame := w.layout.Frame(colors)
+
+	for start := 0; start < w.layout.Pixels; start += wledMaxPixels {
+		end := start + wledMaxPixels
+		if end > w.layout.Pixels {
+			end = w.layout.Pixels
+		}
+
+		packet := make([]byte, wledHeaderSize+(end-start)*3)
+		packet[0] = wledDNRGB
+		packet[1] = wledTimeout
+		binary.BigEndian.PutUint16(packet[2:], uint16(w.layout.Offset+start))
+		copy(packet[wledHeaderSize:], frame[start*3:end*3])
+
+		if err := w.send(w.addr, packet); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stop closes the socket.
+func (w *WLED) Stop() error {
+	return w.stop()
+}
@@ -0,0 +1,24 @@
+package sink
+
+import (
+	"testing"
+
+	"github.com/lucasb-eyer/go-colorful"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWLED(t *testing.T) {
+	conn, addr := listen(t)
+
+	w, err := NewWLED(addr, Layout{Pixels: 3, Offset: 300, Map: map[int][]int{7: {0, 2}}})
+	assert.NoError(t, err)
+	assert.NoError(t, w.Start())
+	defer w.Stop()
+
+	assert.NoError(t, w.Set(map[int]colorful.Color{7: blue}))
+	assert.Equal(t, []byte{
+		4, 2, // DNRGB, timeout
+		0x01, 0x2c, // start index
+		0, 0, 255, 0, 0, 0, 0, 0, 255,
+	}, receive(t, conn))
+}
@@ -0,0 +1,102 @@
+package video
+
+import (
+	"bytes"
+	"os"
+	"unsafe"
+
+	"github.com/Khabi/chromatic/internal/decode"
+	"golang.org/x/sys/unix"
+)
+
+// v4l2 ioctls and capabilities, see linux/videodev2.h.
+const (
+	vidiocQuerycap = 0x80685600 // _IOR('V', 0, struct v4l2_capability)
+	vidiocEnumFmt  = 0xc0405602 // _IOWR('V', 2, struct v4l2_fmtdesc)
+
+	capVideoCapture = 0x00000001
+	capStreaming    = 0x04000000
+	capDeviceCaps   = 0x80000000
+
+	bufTypeVideoCapture = 1
+)
+
+type v4l2Capability struct {
+	driver       [16]byte
+	card         [32]byte
+	busInfo      [32]byte
+	version      uint32
+	capabilities uint32
+	deviceCaps   uint32
+	reserved     [3]uint32
+}
+
+type v4l2Fmtdesc struct {
+	index       uint32
+	typ         uint32
+	flags       uint32
+	description [32]byte
+	pixelformat uint32
+	mbusCode    uint32
+	reserved    [3]uint32
+}
+
+// query reads the capabilities and capture formats of a device node.
+func query(path string) (Device, error) {
+	fd, err := unix.Open(path, unix.O_RDWR|unix.O_NONBLOCK|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return Device{}, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	defer unix.Close(fd)
+
+	var c v4l2Capability
+	if err := ioctl(fd, vidiocQuerycap, unsafe.Pointer(&c)); err != nil {
+		return Device{}, &os.PathError{Op: "query", Path: path, Err: err}
+	}
+	// Capabilities are for the whole device, a node can do less.
+	caps := c.capabilities
+	if caps&capDeviceCaps != 0 {
+		caps = c.deviceCaps
+	}
+
+	d := Device{
+		Path:      path,
+		Name:      cString(c.card[:]),
+		Driver:    cString(c.driver[:]),
+		Bus:       cString(c.busInfo[:]),
+		Capture:   caps&capVideoCapture != 0,
+		Streaming: caps&capStreaming != 0,
+	}
+	if !d.Capture {
+		return d, nil
+	}
+
+	for i := uint32(0); ; i++ {
+		f := v4l2Fmtdesc{index: i, typ: bufTypeVideoCapture}
+		if err := ioctl(fd, vidiocEnumFmt, unsafe.Pointer(&f)); err != nil {
+			break // EINVAL after the last format
+		}
+		d.Formats = append(d.Formats, decode.FormatName(f.pixelformat))
+	}
+	return d, nil
+}
+
+func ioctl(fd int, req uintptr, arg unsafe.Pointer) error {
+	for {
+		_, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), req, uintptr(arg))
+		switch errno {
+		case 0:
+			return nil
+		case unix.EINTR:
+			continue
+		}
+		return errno
+	}
+}
+
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
@@ -0,0 +1,178 @@
+// Package video finds capture devices and resolves the names they are
+// configured by.
+package video
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Khabi/chromatic/internal/decode"
+)
+
+// ByIDDir holds a link to each device named after its hardware, unlike
+// /dev/videoN these stay the same across reboots.
+const ByIDDir = "/dev/v4l/by-id"
+
+// Device is a video device node.
+type Device struct {
+	Path      string   `json:"path"`
+	ByID      []string `json:"by_id,omitempty"` // stable links to the node
+	Name      string   `json:"name"`            // the card name
+	Driver    string   `json:"driver"`
+	Bus       string   `json:"bus"`
+	Capture   bool     `json:"capture"` // false for metadata and output nodes
+	Streaming bool     `json:"streaming"`
+	Formats   []string `json:"formats,omitempty"`
+}
+
+// Supports reports whether the device can capture in a format.
+func (d Device) Supports(format string) bool {
+	for _, f := range d.Formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// SupportsMJPEG reports whether the device captures mjpeg, the format
+// chromatic uses by default.
+func (d Device) SupportsMJPEG() bool {
+	return d.Supports(decode.FormatMJPEG)
+}
+
+// Stable is the path that survives a reboot, when there is one.
+func (d Device) Stable() string {
+	if len(d.ByID) > 0 {
+		return d.ByID[0]
+	}
+	return d.Path
+}
+
+// Find lists every video device node, in the order of their numbers.
+func Find() ([]Device, error) {
+	paths, err := filepath.Glob("/dev/video*")
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		return nodeNumber(paths[i]) < nodeNumber(paths[j])
+	})
+
+	links := byID(ByIDDir)
+	var devices []Device
+	for _, path := range paths {
+		d, err := query(path)
+		if err != nil {
+			continue // gone, or not ours to open
+		}
+		d.ByID = links[path]
+		devices = append(devices, d)
+	}
+	return devices, nil
+}
+
+// Resolve turns a configured device into a path.  Paths are used as
+// they are, anything else is a link in ByIDDir or a card name.
+func Resolve(device string) (string, error) {
+	if strings.HasPrefix(device, "/") {
+		return device, nil
+	}
+	devices, err := Find()
+	if err != nil {
+		return "", err
+	}
+	return match(device, devices)
+}
+
+// StablePath returns a link in ByIDDir to the device at path, so it is
+// found again if it comes back with another number.  Names, and paths
+// without a link, are returned as they are.
+func StablePath(path string) string {
+	return stablePath(path, ByIDDir)
+}
+
+func stablePath(path, dir string) string {
+	if !strings.HasPrefix(path, "/") {
+		return path
+	}
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return path
+	}
+	links := byID(dir)[target]
+	for _, link := range links {
+		if link == path {
+			return path
+		}
+	}
+	if len(links) > 0 {
+		return links[0]
+	}
+	return path
+}
+
+// match finds the capture device a name refers to.
+func match(name string, devices []Device) (string, error) {
+	var found []Device
+	for _, d := range devices {
+		if !d.Capture {
+			continue
+		}
+		for _, link := range d.ByID {
+			if filepath.Base(link) == name {
+				return d.Path, nil
+			}
+		}
+		if d.Name == name {
+			found = append(found, d)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return "", fmt.Errorf("no capture device named %q", name)
+	case 1:
+		return found[0].Path, nil
+	}
+	var paths []string
+	for _, d := range found {
+		paths = append(paths, d.Stable())
+	}
+	return "", fmt.Errorf("%q matches %s, use one of their paths", name, strings.Join(paths, ", "))
+}
+
+// byID maps each device node to the links in dir that point to it.
+func byID(dir string) map[string][]string {
+	links := make(map[string][]string)
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return links // no devices with ids
+	}
+	for _, e := range entries {
+		link := filepath.Join(dir, e.Name())
+		if e.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+		target, err := filepath.EvalSymlinks(link)
+		if err != nil {
+			continue
+		}
+		links[target] = append(links[target], link)
+	}
+	return links
+}
+
+// nodeNumber is N in /dev/videoN, so video10 sorts after video9.
+func nodeNumber(path string) int {
+	n, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(path), "video"))
+	if err != nil {
+		return -1
+	}
+	return n
+}
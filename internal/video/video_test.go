@@ -0,0 +1,86 @@
+package video
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestByID(t *testing.T) {
+	dir, err := ioutil.TempDir("", "by-id")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	node := filepath.Join(dir, "video0")
+	assert.NoError(t, ioutil.WriteFile(node, nil, 0600))
+	ids := filepath.Join(dir, "by-id")
+	assert.NoError(t, os.Mkdir(ids, 0700))
+	link := filepath.Join(ids, "usb-Capture_Card-video-index0")
+	assert.NoError(t, os.Symlink("../video0", link))
+	assert.NoError(t, os.Symlink("../missing", filepath.Join(ids, "usb-Gone-video-index0")))
+
+	// Temp directories can be behind a link themselves.
+	node, err = filepath.EvalSymlinks(node)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{node: {link}}, byID(ids))
+	assert.Empty(t, byID(filepath.Join(dir, "missing")))
+
+	assert.Equal(t, link, stablePath(node, ids))
+	assert.Equal(t, link, stablePath(link, ids))
+	assert.Equal(t, "Capture Card", stablePath("Capture Card", ids))
+	assert.Equal(t, "/dev/missing", stablePath("/dev/missing", ids))
+}
+
+func TestMatch(t *testing.T) {
+	devices := []Device{
+		{Path: "/dev/video0", Name: "HD Webcam", Capture: true, ByID: []string{"/dev/v4l/by-id/usb-Webcam-video-index0"}},
+		{Path: "/dev/video1", Name: "HD Webcam", ByID: []string{"/dev/v4l/by-id/usb-Webcam-video-index1"}},
+		{Path: "/dev/video2", Name: "USB3 Video", Capture: true, ByID: []string{"/dev/v4l/by-id/usb-MACROSILICON_USB3_Video-video-index0"}},
+		{Path: "/dev/video4", Name: "USB3 Video", Capture: true},
+	}
+
+	var tests = []struct {
+		name     string
+		expected string
+		err      string
+	}{
+		{"HD Webcam", "/dev/video0", ""},
+		{"usb-MACROSILICON_USB3_Video-video-index0", "/dev/video2", ""},
+		{"usb-Webcam-video-index1", "", `no capture device named "usb-Webcam-video-index1"`},
+		{"USB3 Video", "", `"USB3 Video" matches /dev/v4l/by-id/usb-MACROSILICON_USB3_Video-video-index0, /dev/video4, use one of their paths`},
+	}
+
+	for _, td := range tests {
+		t.Run(td.name, func(t *testing.T) {
+			path, err := match(td.name, devices)
+			if td.err != "" {
+				assert.EqualError(t, err, td.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, td.expected, path)
+		})
+	}
+}
+
+func TestDevice(t *testing.T) {
+	d := Device{Path: "/dev/video0", Formats: []string{"mjpeg", "yuyv"}}
+	assert.True(t, d.SupportsMJPEG())
+	assert.True(t, d.Supports("yuyv"))
+	assert.False(t, d.Supports("nv12"))
+	assert.Equal(t, "/dev/video0", d.Stable())
+
+	d.ByID = []string{"/dev/v4l/by-id/usb-Webcam-video-index0"}
+	assert.Equal(t, "/dev/v4l/by-id/usb-Webcam-video-index0", d.Stable())
+
+	assert.Equal(t, 10, nodeNumber("/dev/video10"))
+}
+
+func TestResolvePath(t *testing.T) {
+	path, err := Resolve("/dev/v4l/by-id/usb-Webcam-video-index0")
+	assert.NoError(t, err)
+	assert.Equal(t, "/dev/v4l/by-id/usb-Webcam-video-index0", path)
+}